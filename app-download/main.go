@@ -27,6 +27,7 @@ func routes() http.Handler {
 
 	// routes
 	mux.HandleFunc("/download", downloadFile)
+	mux.HandleFunc("/list", listFiles)
 
 	return mux
 }
@@ -34,4 +35,9 @@ func routes() http.Handler {
 func downloadFile(w http.ResponseWriter, r *http.Request) {
 	var t toolkit.Tools
 	t.DownloadStaticFile(w, r, "./files", "image.jpeg", "netflix.jpeg")
-}
\ No newline at end of file
+}
+
+func listFiles(w http.ResponseWriter, r *http.Request) {
+	var t toolkit.Tools
+	_ = t.ServeDirectory(w, r, "./files", "/files/")
+}
@@ -18,6 +18,8 @@ type ResponsePayload struct {
 }
 
 func main() {
+	var t toolkit.Tools
+
 	mux := http.NewServeMux()
 
 	mux.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir("."))))
@@ -28,7 +30,7 @@ func main() {
 
 	log.Println("starting service...")
 
-	err := http.ListenAndServe(":8081", mux)
+	err := http.ListenAndServe(":8081", toolkit.Chain(mux, t.RequestID, t.Recoverer, t.AccessLog, t.Compress))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -65,7 +67,9 @@ func remoteService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, statusCode, err := t.PushJSONToRemote("http://localhost:8081/simulated-service", requestPayload)
+	// using the request context, if our client gives up
+	// there's no point in waiting for the remote service
+	_, statusCode, err := t.PushJSONToRemoteContext(r.Context(), "http://localhost:8081/simulated-service", requestPayload)
 	if err != nil {
 		t.ErrorJSONResponse(w, err)
 		return
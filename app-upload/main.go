@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/kcalixto/go-module/toolkit"
 )
@@ -20,21 +21,29 @@ func main() {
 }
 
 func routes() http.Handler {
+	var t toolkit.Tools
+
 	mux := http.NewServeMux()
 
+	postOnly := t.AllowMethods(http.MethodPost)
+
+	// uploads are expensive, 10 a minute per ip in bursts of up to 5
+	limited := t.RateLimit(toolkit.RateLimitOptions{
+		Routes: map[string]toolkit.RateLimit{
+			"/upload":     {Requests: 10, Per: time.Minute, Burst: 5},
+			"/upload-one": {Requests: 10, Per: time.Minute, Burst: 5},
+		},
+	})
+
 	mux.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir("."))))
-	mux.HandleFunc("/upload", uploadFiles)
-	mux.HandleFunc("/upload-one", uploadOneFile)
+	mux.Handle("/upload", postOnly(http.HandlerFunc(uploadFiles)))
+	mux.Handle("/upload-one", postOnly(http.HandlerFunc(uploadOneFile)))
+	mux.HandleFunc("/list", listUploads)
 
-	return mux
+	return toolkit.Chain(mux, t.RequestID, t.Recoverer, t.AccessLog, t.Compress, limited)
 }
 
 func uploadFiles(w http.ResponseWriter, req *http.Request) {
-	if req.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	t := toolkit.Tools{
 		MaxFileSize:      1024 * 1024 * 1024, // ~1gb
 		AllowedFileTypes: []string{"image/jpeg", "image/png", "image/gif"},
@@ -55,11 +64,6 @@ func uploadFiles(w http.ResponseWriter, req *http.Request) {
 }
 
 func uploadOneFile(w http.ResponseWriter, req *http.Request) {
-	if req.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	t := toolkit.Tools{
 		MaxFileSize:      1024 * 1024 * 1024, // ~1gb
 		AllowedFileTypes: []string{"image/jpeg", "image/png", "image/gif"},
@@ -75,3 +79,10 @@ func uploadOneFile(w http.ResponseWriter, req *http.Request) {
 
 	_, _ = w.Write([]byte(out))
 }
+
+func listUploads(w http.ResponseWriter, req *http.Request) {
+	var t toolkit.Tools
+
+	// files are served by the file server at /uploads/
+	_ = t.ServeDirectory(w, req, "./uploads", "/uploads/")
+}
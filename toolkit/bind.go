@@ -0,0 +1,268 @@
+package toolkit
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// BindError is returned by Bind when a value can't be converted to
+// the type of the field it goes into
+type BindError struct {
+	// "path", "query", "form" or "header"
+	Source string
+	// the name in the tag, like "page" or "X-Tenant"
+	Name  string
+	Value string
+	// what the field wanted, like "an integer"
+	Expected string
+	Err      error
+}
+
+func (e *BindError) Error() string {
+	return fmt.Sprintf("%s %q must be %s, got %q", bindSourceNames[e.Source], e.Name, e.Expected, e.Value)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// in the order they're looked at, the first one with a value wins
+var bindSources = []string{"path", "query", "form", "header"}
+
+var bindSourceNames = map[string]string{
+	"path":   "path parameter",
+	"query":  "query parameter",
+	"form":   "form field",
+	"header": "header",
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// layouts tried for time.Time fields
+var bindTimeLayouts = []string{time.RFC3339Nano, "2006-01-02"}
+
+// memory used by multipart forms, the rest goes to temp files
+const bindMaxMultipartMemory = 32 << 20
+
+// Bind fills the struct dst points to from the request. A JSON body is
+// read first, with ReadJSON and its rules, then fields tagged with path,
+// query, form or header take the value from there, like
+//
+//	type Search struct {
+//		Page   int      `query:"page"`
+//		Tags   []string `query:"tag"`
+//		Tenant string   `header:"X-Tenant"`
+//		Title  string   `form:"title"`
+//		ID     UUID     `path:"id"`
+//	}
+//
+// Fields with several tags take the first source that has a value, in
+// that order. Absent values leave fields as they are, so defaults can be
+// set before calling it. Strings, bools, ints, uints, floats, time.Duration,
+// time.Time (RFC 3339 or a date), anything implementing
+// encoding.TextUnmarshaler and slices and pointers of those are converted,
+// a slice taking every value sent. Path parameters come from the
+// http.ServeMux pattern, like "/items/{id}"
+func (t *Tools) Bind(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("bind destination must be a non-nil pointer to a struct")
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if isJSONMediaType(mediaType) && r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		// there's no writer to tell about a body too large, the error is enough
+		if err := t.ReadJSON(nil, r, dst); err != nil {
+			return err
+		}
+	}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return fmt.Errorf("body contains a badly-formed form: %w", err)
+		}
+
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(bindMaxMultipartMemory); err != nil {
+			return fmt.Errorf("body contains a badly-formed form: %w", err)
+		}
+	}
+
+	return bindStruct(r, v.Elem())
+}
+
+func bindStruct(r *http.Request, v reflect.Value) error {
+	typ := v.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		// embedded structs are filled like they were part of this one
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := bindStruct(r, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		for _, source := range bindSources {
+			name := field.Tag.Get(source)
+			if name == "" || name == "-" {
+				continue
+			}
+
+			values := bindValues(r, source, name)
+			if len(values) == 0 {
+				continue
+			}
+
+			bad, expected, err := setField(v.Field(i), values)
+			if err != nil && expected == "" {
+				// a field we can't fill, that's on the caller
+				return err
+			}
+			if err != nil {
+				return &BindError{Source: source, Name: name, Value: bad, Expected: expected, Err: err}
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
+
+// the values sent for name in source, nil when there are none
+func bindValues(r *http.Request, source, name string) []string {
+	switch source {
+	case "path":
+		if value := r.PathValue(name); value != "" {
+			return []string{value}
+		}
+		return nil
+
+	case "query":
+		return r.URL.Query()[name]
+
+	case "form":
+		if r.PostForm == nil {
+			return nil
+		}
+		return r.PostForm[name]
+
+	default:
+		return r.Header.Values(name)
+	}
+}
+
+// sets values on field, returning the one that didn't fit and what was expected
+func setField(field reflect.Value, values []string) (string, string, error) {
+	// some slices, like net.IP, parse themselves from a single value
+	if field.Kind() == reflect.Slice && !field.Addr().Type().Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if expected, err := setValue(slice.Index(i), value); err != nil {
+				return value, expected, err
+			}
+		}
+
+		field.Set(slice)
+		return "", "", nil
+	}
+
+	expected, err := setValue(field, values[0])
+
+	return values[0], expected, err
+}
+
+func setValue(field reflect.Value, value string) (string, error) {
+	if field.Kind() == reflect.Pointer {
+		ptr := reflect.New(field.Type().Elem())
+		if expected, err := setValue(ptr.Elem(), value); err != nil {
+			return expected, err
+		}
+
+		field.Set(ptr)
+		return "", nil
+	}
+
+	switch {
+	case field.Type() == timeType:
+		for _, layout := range bindTimeLayouts {
+			if tm, err := time.Parse(layout, value); err == nil {
+				field.Set(reflect.ValueOf(tm))
+				return "", nil
+			}
+		}
+		return "a time", errors.New("invalid time")
+
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return "a duration", err
+		}
+		field.SetInt(int64(d))
+		return "", nil
+
+	case field.Addr().Type().Implements(textUnmarshalerType):
+		err := field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+		if err != nil {
+			return "a valid value", err
+		}
+		return "", nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "a boolean", err
+		}
+		field.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return "an integer", err
+		}
+		field.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return "a positive integer", err
+		}
+		field.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return "a number", err
+		}
+		field.SetFloat(f)
+
+	default:
+		return "", fmt.Errorf("can't bind into a %s", field.Type())
+	}
+
+	return "", nil
+}
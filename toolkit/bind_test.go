@@ -0,0 +1,214 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindEmbedded struct {
+	Tenant string `header:"X-Tenant"`
+}
+
+type bindTarget struct {
+	bindEmbedded
+	ID       UUID          `path:"id"`
+	Page     int           `query:"page"`
+	PerPage  uint8         `query:"per_page"`
+	Tags     []string      `query:"tag"`
+	Scores   []float64     `query:"score"`
+	Draft    bool          `query:"draft" form:"draft"`
+	Title    string        `form:"title" json:"title"`
+	Since    time.Time     `query:"since"`
+	Timeout  time.Duration `header:"X-Timeout"`
+	Limit    *int          `query:"limit"`
+	From     net.IP        `header:"X-From"`
+	Body     string        `json:"body"`
+	Sort     string        `query:"sort"`
+	internal string        `query:"internal"`
+}
+
+var bindTests = []struct {
+	testName    string
+	url         string
+	contentType string
+	body        string
+	headers     map[string]string
+	expected    bindTarget
+	errorText   string
+}{
+	{
+		testName: "query",
+		url:      "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10?page=2&per_page=50&tag=a&tag=b&score=1.5&draft=true&since=2024-05-01&limit=7&internal=x",
+		expected: bindTarget{
+			ID:      UUID{0x01, 0x90, 0xa6, 0xb1, 0x8f, 0x27, 0x7a, 0x3c, 0x9d, 0x1e, 0x5b, 0x2f, 0x8c, 0x4e, 0x6a, 0x10},
+			Page:    2,
+			PerPage: 50,
+			Tags:    []string{"a", "b"},
+			Scores:  []float64{1.5},
+			Draft:   true,
+			Since:   time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			Limit:   func() *int { n := 7; return &n }(),
+			Sort:    "name",
+		},
+	},
+	{
+		testName: "headers",
+		url:      "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10?since=2024-05-01T10:00:00Z",
+		headers:  map[string]string{"X-Tenant": "acme", "X-Timeout": "1m30s", "X-From": "192.0.2.1"},
+		expected: bindTarget{
+			bindEmbedded: bindEmbedded{Tenant: "acme"},
+			ID:           UUID{0x01, 0x90, 0xa6, 0xb1, 0x8f, 0x27, 0x7a, 0x3c, 0x9d, 0x1e, 0x5b, 0x2f, 0x8c, 0x4e, 0x6a, 0x10},
+			Since:        time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+			Timeout:      90 * time.Second,
+			From:         net.ParseIP("192.0.2.1"),
+			Sort:         "name",
+		},
+	},
+	{
+		testName:    "form, query wins for draft",
+		url:         "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10?draft=false",
+		contentType: "application/x-www-form-urlencoded",
+		body:        "title=Hello&draft=true",
+		expected: bindTarget{
+			ID:    UUID{0x01, 0x90, 0xa6, 0xb1, 0x8f, 0x27, 0x7a, 0x3c, 0x9d, 0x1e, 0x5b, 0x2f, 0x8c, 0x4e, 0x6a, 0x10},
+			Title: "Hello",
+			Sort:  "name",
+		},
+	},
+	{
+		testName:    "json and query",
+		url:         "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10?page=3",
+		contentType: "application/json",
+		body:        `{"title":"Hello","body":"World"}`,
+		expected: bindTarget{
+			ID:    UUID{0x01, 0x90, 0xa6, 0xb1, 0x8f, 0x27, 0x7a, 0x3c, 0x9d, 0x1e, 0x5b, 0x2f, 0x8c, 0x4e, 0x6a, 0x10},
+			Page:  3,
+			Title: "Hello",
+			Body:  "World",
+			Sort:  "name",
+		},
+	},
+	{testName: "bad int", url: "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10?page=two", errorText: `query parameter "page" must be an integer, got "two"`},
+	{testName: "overflow", url: "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10?per_page=300", errorText: `query parameter "per_page" must be a positive integer, got "300"`},
+	{testName: "bad slice item", url: "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10?score=1&score=x", errorText: `query parameter "score" must be a number, got "x"`},
+	{testName: "bad bool", url: "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10?draft=yes", errorText: `query parameter "draft" must be a boolean, got "yes"`},
+	{testName: "bad time", url: "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10?since=yesterday", errorText: `query parameter "since" must be a time, got "yesterday"`},
+	{testName: "bad uuid", url: "/items/nope", errorText: `path parameter "id" must be a valid value, got "nope"`},
+	{testName: "bad header", url: "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10", headers: map[string]string{"X-Timeout": "soon"}, errorText: `header "X-Timeout" must be a duration, got "soon"`},
+	{testName: "bad json", url: "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10", contentType: "application/json", body: `{"title":`, errorText: "body contains badly-formed JSON"},
+	{testName: "wrong json type", url: "/items/0190a6b1-8f27-7a3c-9d1e-5b2f8c4e6a10", contentType: "application/json", body: `{"title":1}`, errorText: `body contains incorrect JSON type for field "title"`},
+}
+
+func TestTools_Bind(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range bindTests {
+		var dst bindTarget
+		var err error
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+			// defaults are kept when nothing is sent
+			dst.Sort = "name"
+			err = testTools.Bind(r, &dst)
+		})
+
+		req := httptest.NewRequest(http.MethodPost, e.url, strings.NewReader(e.body))
+		if e.contentType != "" {
+			req.Header.Set("Content-Type", e.contentType)
+		}
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+
+		if e.errorText != "" {
+			if err == nil || err.Error() != e.errorText {
+				t.Errorf("%s: expected error %q but got %v", e.testName, e.errorText, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", e.testName, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(dst, e.expected) {
+			t.Errorf("%s: expected %+v but got %+v", e.testName, e.expected, dst)
+		}
+	}
+}
+
+func TestTools_BindMultipart(t *testing.T) {
+	var testTools Tools
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("title", "Hello")
+	_ = mw.WriteField("draft", "1")
+	_ = mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var dst struct {
+		Title string `form:"title"`
+		Draft bool   `form:"draft"`
+	}
+
+	if err := testTools.Bind(req, &dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if dst.Title != "Hello" || !dst.Draft {
+		t.Errorf("wrong multipart binding: %+v", dst)
+	}
+}
+
+func TestTools_BindErrors(t *testing.T) {
+	var testTools Tools
+
+	req := httptest.NewRequest(http.MethodGet, "/?page=x", nil)
+
+	var notStruct int
+	if err := testTools.Bind(req, &notStruct); err == nil {
+		t.Error("binding into a non struct should fail")
+	}
+
+	var dst struct {
+		Page int `query:"page"`
+	}
+	if err := testTools.Bind(req, dst); err == nil {
+		t.Error("binding into a non pointer should fail")
+	}
+
+	// structured, and a 400 for ErrorJSONResponse
+	err := testTools.Bind(req, &dst)
+
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) || bindErr.Source != "query" || bindErr.Name != "page" || bindErr.Value != "x" {
+		t.Errorf("expected a BindError, got %#v", err)
+	}
+
+	if errorStatus(err) != http.StatusBadRequest {
+		t.Errorf("expected a bad request, got %d", errorStatus(err))
+	}
+
+	var unsupported struct {
+		Things map[string]string `query:"page"`
+	}
+	// a mistake in the code, not in the request
+	if err := testTools.Bind(req, &unsupported); err == nil || errors.As(err, &bindErr) {
+		t.Errorf("an unsupported field type should fail, got %v", err)
+	}
+}
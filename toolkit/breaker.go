@@ -0,0 +1,297 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is matched (with errors.Is) by the error returned from
+// outbound calls when the circuit breaker of the remote host is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned instead of calling a host whose circuit is open
+type CircuitOpenError struct {
+	Host string
+	// how long until the breaker lets a trial call through
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open for %s", e.Host)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitState is the state of the circuit of a single host
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails every call right away
+	CircuitOpen
+	// CircuitHalfOpen lets a few trial calls through after the cool down
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker keeps one circuit per remote host. After FailureThreshold
+// failures in a row the circuit opens and calls fail fast with ErrCircuitOpen,
+// once CoolDown passes a few trial calls decide if it closes again.
+// Set it on Tools.CircuitBreaker, the zero value is ready to use
+type CircuitBreaker struct {
+	// consecutive failures that open the circuit (default 5)
+	FailureThreshold int
+	// how long the circuit stays open before trying again (default 30s)
+	CoolDown time.Duration
+	// trial calls let through while half-open (default 1)
+	HalfOpenMaxCalls int
+	// tells if a call failed, by default transport errors (except
+	// cancellations) and 5xx do
+	IsFailure func(response *http.Response, err error) bool
+	// called whenever a circuit changes state, after the breaker is unlocked
+	OnStateChange func(host string, from, to CircuitState)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	// state changes waiting for OnStateChange, called once unlocked
+	changes []stateChange
+	// swapped in tests
+	now func() time.Time
+}
+
+type stateChange struct {
+	host     string
+	from, to CircuitState
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	inFlight int
+}
+
+func (b *CircuitBreaker) failureThreshold() int {
+	if b.FailureThreshold > 0 {
+		return b.FailureThreshold
+	}
+
+	return 5
+}
+
+func (b *CircuitBreaker) coolDown() time.Duration {
+	if b.CoolDown > 0 {
+		return b.CoolDown
+	}
+
+	return 30 * time.Second
+}
+
+func (b *CircuitBreaker) halfOpenMaxCalls() int {
+	if b.HalfOpenMaxCalls > 0 {
+		return b.HalfOpenMaxCalls
+	}
+
+	return 1
+}
+
+func (b *CircuitBreaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+
+	return time.Now()
+}
+
+func (b *CircuitBreaker) isFailure(response *http.Response, err error) bool {
+	if b.IsFailure != nil {
+		return b.IsFailure(response, err)
+	}
+
+	if err != nil {
+		// our own caller giving up says nothing about the remote
+		return !errors.Is(err, context.Canceled)
+	}
+
+	return response.StatusCode >= 500
+}
+
+// must be called with the lock held
+func (b *CircuitBreaker) circuitFor(host string) *circuit {
+	if b.circuits == nil {
+		b.circuits = make(map[string]*circuit)
+	}
+
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{}
+		b.circuits[host] = c
+	}
+
+	// an open circuit turns half-open by itself once the cool down is over
+	if c.state == CircuitOpen && b.clock().Sub(c.openedAt) >= b.coolDown() {
+		b.setState(host, c, CircuitHalfOpen)
+	}
+
+	return c
+}
+
+// must be called with the lock held
+func (b *CircuitBreaker) setState(host string, c *circuit, state CircuitState) {
+	if c.state == state {
+		return
+	}
+
+	from := c.state
+	c.state = state
+	c.inFlight = 0
+
+	if state == CircuitOpen {
+		c.openedAt = b.clock()
+	}
+
+	if state == CircuitClosed {
+		c.failures = 0
+	}
+
+	if b.OnStateChange != nil {
+		b.changes = append(b.changes, stateChange{host: host, from: from, to: state})
+	}
+}
+
+// unlocks and only then tells OnStateChange, so it may call State and friends
+func (b *CircuitBreaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	for _, change := range changes {
+		b.OnStateChange(change.host, change.from, change.to)
+	}
+}
+
+// State returns the current state of the circuit for host
+func (b *CircuitBreaker) State(host string) CircuitState {
+	b.mu.Lock()
+	defer b.unlock()
+
+	return b.circuitFor(host).state
+}
+
+// States returns the state of every host seen so far
+func (b *CircuitBreaker) States() map[string]CircuitState {
+	b.mu.Lock()
+	defer b.unlock()
+
+	states := make(map[string]CircuitState, len(b.circuits))
+	for host := range b.circuits {
+		states[host] = b.circuitFor(host).state
+	}
+
+	return states
+}
+
+// Reset closes the circuit for host
+func (b *CircuitBreaker) Reset(host string) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.setState(host, b.circuitFor(host), CircuitClosed)
+}
+
+// asks for permission to call host
+func (b *CircuitBreaker) allow(host string) error {
+	b.mu.Lock()
+	defer b.unlock()
+
+	c := b.circuitFor(host)
+
+	switch c.state {
+	case CircuitOpen:
+		return &CircuitOpenError{Host: host, RetryAfter: b.coolDown() - b.clock().Sub(c.openedAt)}
+
+	case CircuitHalfOpen:
+		if c.inFlight >= b.halfOpenMaxCalls() {
+			return &CircuitOpenError{Host: host}
+		}
+		c.inFlight++
+	}
+
+	return nil
+}
+
+// records the outcome of a call allowed before
+func (b *CircuitBreaker) record(host string, response *http.Response, err error) {
+	failed := b.isFailure(response, err)
+
+	b.mu.Lock()
+	defer b.unlock()
+
+	c := b.circuitFor(host)
+
+	switch c.state {
+	case CircuitHalfOpen:
+		// a trial call its own caller gave up on tells nothing either
+		// way, it just makes room for another one
+		if errors.Is(err, context.Canceled) {
+			if c.inFlight > 0 {
+				c.inFlight--
+			}
+			return
+		}
+
+		if failed {
+			b.setState(host, c, CircuitOpen)
+		} else {
+			b.setState(host, c, CircuitClosed)
+		}
+
+	case CircuitClosed:
+		if !failed {
+			c.failures = 0
+			return
+		}
+
+		c.failures++
+		if c.failures >= b.failureThreshold() {
+			b.setState(host, c, CircuitOpen)
+		}
+	}
+}
+
+// sends the request through the circuit breaker of its host, if there is one
+func (t *Tools) send(client *http.Client, request *http.Request) (*http.Response, error) {
+	breaker := t.CircuitBreaker
+	if breaker == nil {
+		return client.Do(request)
+	}
+
+	host := request.URL.Host
+	if err := breaker.allow(host); err != nil {
+		return nil, err
+	}
+
+	response, err := client.Do(request)
+	breaker.record(host, response, err)
+
+	return response, err
+}
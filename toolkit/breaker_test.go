@@ -0,0 +1,185 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTools_CircuitBreaker(t *testing.T) {
+	now := time.Date(2023, 7, 8, 12, 0, 0, 0, time.UTC)
+	status := http.StatusServiceUnavailable
+	calls := 0
+
+	var changes []string
+	breaker := &CircuitBreaker{
+		FailureThreshold: 2,
+		CoolDown:         time.Minute,
+		OnStateChange: func(host string, from, to CircuitState) {
+			changes = append(changes, from.String()+"->"+to.String())
+		},
+		now: func() time.Time { return now },
+	}
+
+	testTools := Tools{
+		CircuitBreaker: breaker,
+		HTTPClient: NewTestClient(func(request *http.Request) *http.Response {
+			calls++
+
+			return &http.Response{
+				StatusCode: status,
+				Body:       io.NopCloser(bytes.NewBufferString("{}")),
+				Header:     make(http.Header),
+			}
+		}),
+	}
+
+	host := "example.com"
+	uri := "http://example.com/some/path"
+
+	// two failures open the circuit
+	for i := 0; i < 2; i++ {
+		_, err := testTools.GetJSON(uri, nil)
+		var remoteErr *RemoteError
+		if !errors.As(err, &remoteErr) {
+			t.Fatalf("expected remote error but got %v", err)
+		}
+	}
+
+	if breaker.State(host) != CircuitOpen {
+		t.Fatalf("expected open circuit but got %s", breaker.State(host))
+	}
+
+	// now it fails fast without calling the remote
+	_, err := testTools.GetJSON(uri, nil)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen but got %v", err)
+	}
+
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || openErr.Host != host || openErr.RetryAfter != time.Minute {
+		t.Errorf("wrong circuit open error: %+v", openErr)
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 calls to the remote but got %d", calls)
+	}
+
+	// other hosts are not affected
+	if breaker.State("other.com") != CircuitClosed {
+		t.Error("circuit of another host should be closed")
+	}
+
+	// after the cool down a failing trial opens it again
+	now = now.Add(time.Minute)
+	if breaker.State(host) != CircuitHalfOpen {
+		t.Fatalf("expected half-open circuit but got %s", breaker.State(host))
+	}
+
+	_, _ = testTools.GetJSON(uri, nil)
+	if breaker.State(host) != CircuitOpen {
+		t.Fatalf("expected open circuit after failed trial but got %s", breaker.State(host))
+	}
+
+	// and a good trial closes it
+	now = now.Add(time.Minute)
+	status = http.StatusOK
+
+	_, err = testTools.GetJSON(uri, nil)
+	if err != nil {
+		t.Errorf("error not expected but got one: %s", err.Error())
+	}
+
+	if breaker.State(host) != CircuitClosed {
+		t.Errorf("expected closed circuit but got %s", breaker.State(host))
+	}
+
+	expected := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected state changes %v but got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("expected state changes %v but got %v", expected, changes)
+			break
+		}
+	}
+}
+
+func TestTools_ErrorJSON_CircuitOpen(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+
+	err := testTools.ErrorJSONResponse(rr, &CircuitOpenError{Host: "example.com"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("wrong status code returned, expected 503, but got %d", rr.Code)
+	}
+}
+
+func TestCircuitBreaker_CancelledTrial(t *testing.T) {
+	now := time.Now()
+	breaker := &CircuitBreaker{FailureThreshold: 1, CoolDown: time.Minute, now: func() time.Time { return now }}
+	host := "example.com"
+
+	_ = breaker.allow(host)
+	breaker.record(host, nil, errors.New("connection refused"))
+
+	now = now.Add(time.Minute)
+
+	if err := breaker.allow(host); err != nil {
+		t.Fatal(err)
+	}
+
+	// the only trial slot is taken
+	if err := breaker.allow(host); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen but got %v", err)
+	}
+
+	// cancelled by its caller, so nothing is known about the host yet
+	breaker.record(host, nil, context.Canceled)
+
+	if breaker.State(host) != CircuitHalfOpen {
+		t.Errorf("expected the circuit to stay half-open but got %s", breaker.State(host))
+	}
+
+	if err := breaker.allow(host); err != nil {
+		t.Errorf("the slot should be free for another trial, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_OnStateChangeUnlocked(t *testing.T) {
+	var states []CircuitState
+	breaker := &CircuitBreaker{FailureThreshold: 1}
+	breaker.OnStateChange = func(host string, from, to CircuitState) {
+		// would deadlock if called with the lock held
+		states = append(states, breaker.State(host))
+		_ = breaker.States()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = breaker.allow("example.com")
+		breaker.record("example.com", nil, errors.New("connection refused"))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnStateChange deadlocked")
+	}
+
+	if len(states) != 1 || states[0] != CircuitOpen {
+		t.Errorf("expected the callback to see the open circuit, got %v", states)
+	}
+}
@@ -0,0 +1,172 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// RemoteResponse holds what came back from a remote JSON call,
+// the body itself is decoded into the target given to SendJSON
+type RemoteResponse struct {
+	StatusCode int
+	Header     http.Header
+}
+
+// RemoteError is returned by SendJSON when the remote
+// service answers with a status outside the 2xx range
+type RemoteError struct {
+	StatusCode int
+	Header     http.Header
+	// the raw body, use DecodeBody to read it into a struct
+	Body []byte
+	// the message field, when the remote answered with a JSONResponse
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("remote service returned status %d: %s", e.StatusCode, e.Message)
+	}
+
+	return fmt.Sprintf("remote service returned status %d", e.StatusCode)
+}
+
+// DecodeBody decodes the error body sent by the remote into v
+func (e *RemoteError) DecodeBody(v interface{}) error {
+	return json.Unmarshal(e.Body, v)
+}
+
+// GetJSON calls uri with GET and decodes the response into target
+func (t *Tools) GetJSON(uri string, target interface{}, opts ...RequestOption) (*RemoteResponse, error) {
+	return t.SendJSON(http.MethodGet, uri, nil, target, opts...)
+}
+
+// PostJSON sends payload to uri with POST and decodes the response into target
+func (t *Tools) PostJSON(uri string, payload, target interface{}, opts ...RequestOption) (*RemoteResponse, error) {
+	return t.SendJSON(http.MethodPost, uri, payload, target, opts...)
+}
+
+// PutJSON sends payload to uri with PUT and decodes the response into target
+func (t *Tools) PutJSON(uri string, payload, target interface{}, opts ...RequestOption) (*RemoteResponse, error) {
+	return t.SendJSON(http.MethodPut, uri, payload, target, opts...)
+}
+
+// PatchJSON sends payload to uri with PATCH and decodes the response into target
+func (t *Tools) PatchJSON(uri string, payload, target interface{}, opts ...RequestOption) (*RemoteResponse, error) {
+	return t.SendJSON(http.MethodPatch, uri, payload, target, opts...)
+}
+
+// SendJSON sends payload (if not nil) as JSON to uri and decodes the
+// response body into target (if not nil). A non 2xx status comes back as
+// a *RemoteError along with the response. Requests go through HTTPClient,
+// or a default client when it isn't set. opts add headers, auth and signatures
+func (t *Tools) SendJSON(method, uri string, payload, target interface{}, opts ...RequestOption) (*RemoteResponse, error) {
+	return t.SendJSONContext(context.Background(), method, uri, payload, target, opts...)
+}
+
+// SendJSONContext is SendJSON bound to ctx, see PushJSONToRemoteContext
+func (t *Tools) SendJSONContext(ctx context.Context, method, uri string, payload, target interface{}, opts ...RequestOption) (*RemoteResponse, error) {
+	var body io.Reader
+	var jsonData []byte
+	if payload != nil {
+		var err error
+		jsonData, err = json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(jsonData)
+	}
+
+	ctx, cancel := t.remoteContext(ctx)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Accept", "application/json")
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	client, err := t.applyRequestOptions(request, jsonData, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := t.do(client, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	maxBytes := 10 * 1024 * 1024 // 10mb
+	if t.MaxRemoteResponseSize != 0 {
+		maxBytes = t.MaxRemoteResponseSize
+	}
+
+	// reading one byte past the limit is how
+	// we find out the remote sent too much
+	data, err := io.ReadAll(io.LimitReader(response.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxBytes {
+		return nil, fmt.Errorf("remote response must not be larger than %d bytes", maxBytes)
+	}
+
+	res := &RemoteResponse{
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		remoteErr := &RemoteError{
+			StatusCode: response.StatusCode,
+			Header:     response.Header,
+			Body:       data,
+		}
+
+		var payload JSONResponse
+		if json.Unmarshal(data, &payload) == nil {
+			remoteErr.Message = payload.Message
+		}
+
+		return res, remoteErr
+	}
+
+	if target != nil && len(bytes.TrimSpace(data)) > 0 {
+		err = json.Unmarshal(data, target)
+		if err != nil {
+			return res, fmt.Errorf("error decoding remote response: %w", err)
+		}
+	}
+
+	return res, nil
+}
+
+// the client used for outbound calls
+func (t *Tools) httpClient() *http.Client {
+	if t.HTTPClient != nil {
+		return t.HTTPClient
+	}
+
+	return &http.Client{}
+}
+
+// adds RemoteTimeout to ctx, unless ctx already ends sooner
+func (t *Tools) remoteContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := 30 * time.Second
+	if t.RemoteTimeout != 0 {
+		timeout = t.RemoteTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
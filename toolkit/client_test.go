@@ -0,0 +1,177 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var sendJSONTests = []struct {
+	testName        string
+	method          string
+	payload         interface{}
+	status          int
+	body            string
+	expectedMessage string
+	errorExpected   bool
+	remoteError     bool
+}{
+	{testName: "get", method: http.MethodGet, status: http.StatusOK, body: `{"error": false, "message": "hello"}`, expectedMessage: "hello"},
+	{testName: "post", method: http.MethodPost, payload: map[string]string{"foo": "bar"}, status: http.StatusCreated, body: `{"message": "created"}`, expectedMessage: "created"},
+	{testName: "put", method: http.MethodPut, payload: map[string]string{"foo": "bar"}, status: http.StatusOK, body: `{"message": "updated"}`, expectedMessage: "updated"},
+	{testName: "no content", method: http.MethodPatch, payload: map[string]string{"foo": "bar"}, status: http.StatusNoContent, body: ""},
+	{testName: "remote error", method: http.MethodPost, payload: map[string]string{"foo": "bar"}, status: http.StatusUnprocessableEntity, body: `{"error": true, "message": "bad foo"}`, errorExpected: true, remoteError: true},
+	{testName: "badly formed response", method: http.MethodGet, status: http.StatusOK, body: `{"message":`, errorExpected: true},
+}
+
+func TestTools_SendJSON(t *testing.T) {
+	for _, e := range sendJSONTests {
+		var sentBody []byte
+		var sentRequest *http.Request
+
+		testTools := Tools{
+			HTTPClient: NewTestClient(func(request *http.Request) *http.Response {
+				sentRequest = request
+				if request.Body != nil {
+					sentBody, _ = io.ReadAll(request.Body)
+				}
+
+				return &http.Response{
+					StatusCode: e.status,
+					Body:       io.NopCloser(bytes.NewBufferString(e.body)),
+					Header:     http.Header{"X-Foo": []string{"bar"}},
+				}
+			}),
+		}
+
+		var target JSONResponse
+		res, err := testTools.SendJSON(e.method, "http://example.com/some/path", e.payload, &target)
+
+		if sentRequest.Method != e.method {
+			t.Errorf("%s: wrong method sent: %s", e.testName, sentRequest.Method)
+		}
+
+		if e.payload != nil {
+			expected, _ := json.Marshal(e.payload)
+			if !bytes.Equal(sentBody, expected) {
+				t.Errorf("%s: wrong body sent: %s", e.testName, sentBody)
+			}
+
+			if sentRequest.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("%s: wrong content type sent", e.testName)
+			}
+		}
+
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected but none received", e.testName)
+			}
+
+			var remoteErr *RemoteError
+			if e.remoteError {
+				if !errors.As(err, &remoteErr) {
+					t.Errorf("%s: expected RemoteError but got %v", e.testName, err)
+					continue
+				}
+
+				if remoteErr.StatusCode != e.status || remoteErr.Message != "bad foo" {
+					t.Errorf("%s: wrong remote error: %+v", e.testName, remoteErr)
+				}
+
+				var payload JSONResponse
+				if err := remoteErr.DecodeBody(&payload); err != nil || !payload.Error {
+					t.Errorf("%s: failed to decode the error body", e.testName)
+				}
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.testName, err.Error())
+			continue
+		}
+
+		if res.StatusCode != e.status || res.Header.Get("X-Foo") != "bar" {
+			t.Errorf("%s: wrong response: %+v", e.testName, res)
+		}
+
+		if target.Message != e.expectedMessage {
+			t.Errorf("%s: expected message %q but got %q", e.testName, e.expectedMessage, target.Message)
+		}
+	}
+}
+
+func TestTools_SendJSON_TooLarge(t *testing.T) {
+	testTools := Tools{
+		MaxRemoteResponseSize: 10,
+		HTTPClient: NewTestClient(func(request *http.Request) *http.Response {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`{"message": "way too long"}`)),
+				Header:     make(http.Header),
+			}
+		}),
+	}
+
+	_, err := testTools.GetJSON("http://example.com/some/path", nil)
+	if err == nil || !strings.Contains(err.Error(), "must not be larger than 10 bytes") {
+		t.Errorf("expected size error but got %v", err)
+	}
+}
+
+func TestTools_RemoteTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	testTools := Tools{RemoteTimeout: 50 * time.Millisecond}
+
+	start := time.Now()
+	_, _, err := testTools.PushJSONToRemote(server.URL, map[string]string{"foo": "bar"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded but got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Errorf("call should have timed out quickly, took %s", time.Since(start))
+	}
+}
+
+func TestTools_SendJSONContext_Cancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	var testTools Tools
+
+	// cancelling the parent, like a client hanging up on our handler,
+	// must cancel the outbound call, retries included
+	testTools.RetryPolicy = &RetryPolicy{InitialBackoff: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := testTools.SendJSONContext(ctx, http.MethodPost, server.URL, map[string]string{"foo": "bar"}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled but got %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ContentEncoder describes a content coding (gzip, deflate, br...)
+// the toolkit can use to compress responses and decompress requests.
+// Either function may be nil if that direction is not supported.
+type ContentEncoder struct {
+	Name      string
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+// GzipEncoder is the gzip content coding
+var GzipEncoder = ContentEncoder{
+	Name: "gzip",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+}
+
+// DeflateEncoder is the HTTP "deflate" content coding, which
+// despite the name is the zlib format (RFC 9110)
+var DeflateEncoder = ContentEncoder{
+	Name: "deflate",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriter(w), nil
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		return zlib.NewReader(r)
+	},
+}
+
+// returns the encoders configured on Tools, or gzip and deflate.
+// Brotli isn't in the standard library, so to use it just
+// append a ContentEncoder named "br" wrapping your brotli package
+func (t *Tools) contentEncoders() []ContentEncoder {
+	if len(t.ContentEncoders) > 0 {
+		return t.ContentEncoders
+	}
+
+	return []ContentEncoder{GzipEncoder, DeflateEncoder}
+}
+
+// responses smaller than this aren't worth compressing
+func (t *Tools) compressMinSize() int {
+	if t.CompressMinSize != 0 {
+		return t.CompressMinSize
+	}
+
+	return 1024 // 1kb
+}
+
+// adds value to the Vary header, unless it's there already
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), value) {
+				return
+			}
+		}
+	}
+
+	h.Add("Vary", value)
+}
+
+// WriteCompressedJSON works just like WriteJSON, but compresses the body
+// with the best encoding accepted by the client (Accept-Encoding) when
+// the payload is at least CompressMinSize bytes long (default 1kb).
+// To compress every response, WriteJSON ones included, use Compress
+func (t *Tools) WriteCompressedJSON(w http.ResponseWriter, r *http.Request, status int, data interface{}, headers ...http.Header) (err error) {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	minSize := t.compressMinSize()
+
+	if len(headers) > 0 {
+		for k, v := range headers[0] {
+			w.Header()[k] = v
+		}
+	}
+
+	// caches must know that the body changes
+	// depending on what the client accepts
+	addVary(w.Header(), "Accept-Encoding")
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder, ok := t.negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	if !ok || len(out) < minSize {
+		w.WriteHeader(status)
+
+		_, err = w.Write(out)
+		return err
+	}
+
+	var buf bytes.Buffer
+	ew, err := encoder.NewWriter(&buf)
+	if err != nil {
+		return err
+	}
+
+	if _, err = ew.Write(out); err != nil {
+		return err
+	}
+
+	if err = ew.Close(); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Encoding", encoder.Name)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Compress compresses the responses of next with the best encoding accepted
+// by the client, like WriteCompressedJSON, so WriteJSON, ErrorJSONResponse,
+// WritePaginatedJSON and any other handler get it without changes. Bodies
+// under CompressMinSize, already encoded ones, partial content for Range
+// requests and types that don't shrink, like images, are sent as they are
+func (t *Tools) Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Encoding")
+
+		encoder, ok := t.negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		// a Range request is answered with uncompressed bytes, like the
+		// ranges it asks for, so resumed downloads fit together
+		if !ok || encoder.NewWriter == nil || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoder: encoder, minSize: t.compressMinSize()}
+
+		// not deferred, after a panic whatever was buffered is
+		// dropped so Recoverer can still answer with a 500
+		next.ServeHTTP(cw, r)
+		_ = cw.Close()
+	})
+}
+
+// holds the body back until it's big enough to be worth compressing,
+// then sends it through the encoder, or as it is if it never gets there
+type compressWriter struct {
+	http.ResponseWriter
+	encoder ContentEncoder
+	minSize int
+	status  int
+	buf     []byte
+	// the headers went out
+	started bool
+	// set when compressing
+	ew io.WriteCloser
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if !c.started && c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if c.started {
+		if c.ew != nil {
+			return c.ew.Write(b)
+		}
+		return c.ResponseWriter.Write(b)
+	}
+
+	c.buf = append(c.buf, b...)
+	if len(c.buf) >= c.minSize {
+		if err := c.start(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// sends the headers, compressing if asked to and the response allows
+// it, and then what was held back
+func (c *compressWriter) start(compress bool) error {
+	c.started = true
+
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+
+	h := c.Header()
+
+	// net/http would sniff it from the compressed bytes otherwise
+	if h.Get("Content-Type") == "" && len(c.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(c.buf))
+	}
+
+	// ranges count uncompressed bytes, a compressed part would be garbage
+	partial := c.status == http.StatusPartialContent || h.Get("Content-Range") != ""
+
+	if compress && !partial && bodyAllowed(c.status) && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		ew, err := c.encoder.NewWriter(c.ResponseWriter)
+		if err != nil {
+			return err
+		}
+
+		c.ew = ew
+		h.Set("Content-Encoding", c.encoder.Name)
+		h.Del("Content-Length")
+		// ranges of this body would be ranges of the compressed bytes, which
+		// nothing can ask for since they change, so don't offer them
+		h.Del("Accept-Ranges")
+	}
+
+	c.ResponseWriter.WriteHeader(c.status)
+
+	buf := c.buf
+	c.buf = nil
+
+	if len(buf) == 0 {
+		return nil
+	}
+
+	if c.ew != nil {
+		_, err := c.ew.Write(buf)
+		return err
+	}
+
+	_, err := c.ResponseWriter.Write(buf)
+	return err
+}
+
+// sends what's left and finishes the compressed stream
+func (c *compressWriter) Close() error {
+	if !c.started {
+		if c.status == 0 && len(c.buf) == 0 {
+			// nothing written, net/http sends its empty 200
+			return nil
+		}
+
+		// too small to be worth it
+		if err := c.start(false); err != nil {
+			return err
+		}
+	}
+
+	if c.ew != nil {
+		return c.ew.Close()
+	}
+
+	return nil
+}
+
+// Flush sends what's buffered right away, for streaming handlers
+func (c *compressWriter) Flush() {
+	if !c.started {
+		if err := c.start(true); err != nil {
+			return
+		}
+	}
+
+	if f, ok := c.ew.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the real writer
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := c.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, http.ErrNotSupported
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// text and the like shrink, images, videos and archives are compressed already
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-ndjson":
+		return true
+	}
+
+	return false
+}
+
+// picks the encoder with the highest q value in the Accept-Encoding header,
+// ties are broken by the order of our own encoders list
+func (t *Tools) negotiateEncoding(acceptEncoding string) (ContentEncoder, bool) {
+	if acceptEncoding == "" {
+		return ContentEncoder{}, false
+	}
+
+	weights := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if k, v, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(k) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		weights[name] = q
+	}
+
+	var best ContentEncoder
+	bestQ := 0.0
+	for _, e := range t.contentEncoders() {
+		if e.NewWriter == nil {
+			continue
+		}
+
+		q, ok := weights[e.Name]
+		if !ok {
+			q, ok = weights["*"]
+		}
+
+		if ok && q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+
+	return best, bestQ > 0
+}
+
+// wraps the request body with a decompressor when the client sent
+// a Content-Encoding. Note that the size limit is checked against
+// the decompressed data, otherwise a tiny gzip bomb would go right through
+func (t *Tools) decompressBody(w http.ResponseWriter, r *http.Request, maxBytes int) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return nil
+	}
+
+	for _, e := range t.contentEncoders() {
+		if e.Name != encoding || e.NewReader == nil {
+			continue
+		}
+
+		dr, err := e.NewReader(r.Body)
+		if err != nil {
+			return fmt.Errorf("body is not valid %s data", encoding)
+		}
+
+		r.Body = http.MaxBytesReader(w, dr, int64(maxBytes))
+		return nil
+	}
+
+	return &UnsupportedEncodingError{Encoding: encoding}
+}
+
+// UnsupportedEncodingError is returned when the request body was
+// compressed with a Content-Encoding we don't know how to read
+type UnsupportedEncodingError struct {
+	Encoding string
+}
+
+func (e *UnsupportedEncodingError) Error() string {
+	return fmt.Sprintf("unsupported content encoding %q", e.Encoding)
+}
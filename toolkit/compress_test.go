@@ -0,0 +1,387 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var compressTests = []struct {
+	testName         string
+	acceptEncoding   string
+	payloadSize      int
+	expectedEncoding string
+}{
+	{testName: "no accept encoding", acceptEncoding: "", payloadSize: 2048, expectedEncoding: ""},
+	{testName: "gzip", acceptEncoding: "gzip", payloadSize: 2048, expectedEncoding: "gzip"},
+	{testName: "deflate", acceptEncoding: "deflate", payloadSize: 2048, expectedEncoding: "deflate"},
+	{testName: "prefer higher q", acceptEncoding: "gzip;q=0.5, deflate;q=0.8", payloadSize: 2048, expectedEncoding: "deflate"},
+	{testName: "gzip disabled", acceptEncoding: "gzip;q=0, deflate", payloadSize: 2048, expectedEncoding: "deflate"},
+	{testName: "wildcard", acceptEncoding: "*", payloadSize: 2048, expectedEncoding: "gzip"},
+	{testName: "unknown encoding", acceptEncoding: "br", payloadSize: 2048, expectedEncoding: ""},
+	{testName: "below threshold", acceptEncoding: "gzip", payloadSize: 10, expectedEncoding: ""},
+}
+
+func TestTools_WriteCompressedJSON(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range compressTests {
+		payload := JSONResponse{
+			Message: strings.Repeat("a", e.payloadSize),
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		if e.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", e.acceptEncoding)
+		}
+
+		rr := httptest.NewRecorder()
+
+		err := testTools.WriteCompressedJSON(rr, req, http.StatusOK, payload)
+		if err != nil {
+			t.Errorf("%s: failed to write json: %v", e.testName, err)
+			continue
+		}
+
+		if rr.Header().Get("Content-Encoding") != e.expectedEncoding {
+			t.Errorf("%s: expected encoding %q but got %q", e.testName, e.expectedEncoding, rr.Header().Get("Content-Encoding"))
+			continue
+		}
+
+		var body io.Reader = rr.Body
+		switch e.expectedEncoding {
+		case "gzip":
+			body, err = gzip.NewReader(rr.Body)
+		case "deflate":
+			body, err = zlib.NewReader(rr.Body)
+		}
+		if err != nil {
+			t.Errorf("%s: failed to open compressed body: %v", e.testName, err)
+			continue
+		}
+
+		var decoded JSONResponse
+		err = json.NewDecoder(body).Decode(&decoded)
+		if err != nil {
+			t.Errorf("%s: failed to decode body: %v", e.testName, err)
+		}
+
+		if decoded.Message != payload.Message {
+			t.Errorf("%s: wrong message decoded", e.testName)
+		}
+	}
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestTools_ReadJSON_Compressed(t *testing.T) {
+	var testTool Tools
+
+	var decodedJSON struct {
+		Foo string `json:"foo"`
+	}
+
+	// a good gzipped body
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(gzipBytes(t, []byte(`{"foo": "bar"}`))))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	err := testTool.ReadJSON(httptest.NewRecorder(), req, &decodedJSON)
+	if err != nil {
+		t.Error("failed to read gzipped json", err)
+	}
+
+	if decodedJSON.Foo != "bar" {
+		t.Errorf("wrong value decoded, expected bar but got %s", decodedJSON.Foo)
+	}
+
+	// a gzip bomb, tiny when compressed but way over the limit after
+	testTool.MaxJSONSize = 4096
+	bomb := gzipBytes(t, []byte(`{"foo": "`+strings.Repeat("a", 1024*1024)+`"}`))
+	if len(bomb) > testTool.MaxJSONSize {
+		t.Fatalf("compressed payload should fit into the limit, got %d bytes", len(bomb))
+	}
+
+	req = httptest.NewRequest("POST", "/", bytes.NewReader(bomb))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	err = testTool.ReadJSON(httptest.NewRecorder(), req, &decodedJSON)
+	if err == nil || !strings.Contains(err.Error(), "body must not be larger than") {
+		t.Errorf("expected size limit error but got %v", err)
+	}
+
+	// an encoding we don't know
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{"foo": "bar"}`))
+	req.Header.Set("Content-Encoding", "compress")
+
+	err = testTool.ReadJSON(httptest.NewRecorder(), req, &decodedJSON)
+	var encodingErr *UnsupportedEncodingError
+	if !errors.As(err, &encodingErr) {
+		t.Errorf("expected UnsupportedEncodingError but got %v", err)
+	}
+}
+
+var compressMiddlewareTests = []struct {
+	testName         string
+	acceptEncoding   string
+	method           string
+	handler          http.HandlerFunc
+	expectedEncoding string
+	expectedType     string
+}{
+	{
+		testName:       "write json",
+		acceptEncoding: "gzip",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			var tools Tools
+			_ = tools.WriteJSON(w, http.StatusCreated, JSONResponse{Message: strings.Repeat("a", 2048)})
+		},
+		expectedEncoding: "gzip",
+		expectedType:     "application/json",
+	},
+	{
+		testName:       "error json, in small writes",
+		acceptEncoding: "deflate",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			var tools Tools
+			_ = tools.ErrorJSONResponse(w, errors.New(strings.Repeat("b", 2048)))
+		},
+		expectedEncoding: "deflate",
+		expectedType:     "application/json",
+	},
+	{
+		testName:       "too small",
+		acceptEncoding: "gzip",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			var tools Tools
+			_ = tools.WriteJSON(w, http.StatusCreated, JSONResponse{Message: "a"})
+		},
+		expectedEncoding: "",
+		expectedType:     "application/json",
+	},
+	{
+		testName:       "no accept encoding",
+		acceptEncoding: "",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			var tools Tools
+			_ = tools.WriteJSON(w, http.StatusCreated, JSONResponse{Message: strings.Repeat("a", 2048)})
+		},
+		expectedEncoding: "",
+		expectedType:     "application/json",
+	},
+	{
+		testName:       "already compressed",
+		acceptEncoding: "gzip",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			var tools Tools
+			_ = tools.WriteCompressedJSON(w, r, http.StatusCreated, JSONResponse{Message: strings.Repeat("a", 2048)})
+		},
+		expectedEncoding: "gzip",
+		expectedType:     "application/json",
+	},
+	{
+		testName:       "image",
+		acceptEncoding: "gzip",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write(bytes.Repeat([]byte{1}, 2048))
+		},
+		expectedEncoding: "",
+		expectedType:     "image/png",
+	},
+	{
+		testName:       "sniffed type",
+		acceptEncoding: "gzip",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(strings.Repeat("a", 2048)))
+		},
+		expectedEncoding: "gzip",
+		expectedType:     "text/plain; charset=utf-8",
+	},
+	{
+		testName:       "head",
+		acceptEncoding: "gzip",
+		method:         http.MethodHead,
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+		},
+		expectedEncoding: "",
+		expectedType:     "application/json",
+	},
+}
+
+func TestTools_Compress(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range compressMiddlewareTests {
+		method := e.method
+		if method == "" {
+			method = http.MethodGet
+		}
+
+		req := httptest.NewRequest(method, "/", nil)
+		if e.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", e.acceptEncoding)
+		}
+
+		// what the handler sends on its own
+		want := httptest.NewRecorder()
+		e.handler(want, req)
+		expected := decodeBody(t, want)
+
+		rr := httptest.NewRecorder()
+		testTools.Compress(e.handler).ServeHTTP(rr, req)
+
+		if rr.Code != want.Code {
+			t.Errorf("%s: expected status %d but got %d", e.testName, want.Code, rr.Code)
+		}
+
+		if rr.Header().Get("Content-Encoding") != e.expectedEncoding {
+			t.Errorf("%s: expected encoding %q but got %q", e.testName, e.expectedEncoding, rr.Header().Get("Content-Encoding"))
+			continue
+		}
+
+		if rr.Header().Get("Content-Type") != e.expectedType {
+			t.Errorf("%s: expected type %q but got %q", e.testName, e.expectedType, rr.Header().Get("Content-Type"))
+		}
+
+		if vary := rr.Header().Values("Vary"); len(vary) != 1 || vary[0] != "Accept-Encoding" {
+			t.Errorf("%s: expected Vary: Accept-Encoding once, got %v", e.testName, vary)
+		}
+
+		if got := decodeBody(t, rr); !bytes.Equal(got, expected) {
+			t.Errorf("%s: wrong body, got %d bytes but expected %d", e.testName, len(got), len(expected))
+		}
+	}
+}
+
+// the body of rr, decompressed
+func decodeBody(t *testing.T, rr *httptest.ResponseRecorder) []byte {
+	var body io.Reader = rr.Body
+	var err error
+
+	switch rr.Header().Get("Content-Encoding") {
+	case "gzip":
+		body, err = gzip.NewReader(rr.Body)
+	case "deflate":
+		body, err = zlib.NewReader(rr.Body)
+	}
+	if err != nil {
+		t.Fatalf("failed to open compressed body: %v", err)
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+
+	return b
+}
+
+func TestTools_CompressFlush(t *testing.T) {
+	var testTools Tools
+
+	h := testTools.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("data: 2\n\n"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if !rr.Flushed || rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a flushed gzip stream, got %v", rr.Header())
+	}
+
+	gr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := io.ReadAll(gr)
+	if string(got) != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("wrong stream: %q", got)
+	}
+}
+
+func TestTools_CompressRange(t *testing.T) {
+	var testTools Tools
+
+	content := strings.Repeat("hello world\n", 1000)
+	h := testTools.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "a.txt", time.Time{}, strings.NewReader(content))
+	}))
+
+	// resuming a download gets the plain bytes it asked for
+	req := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=100-")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusPartialContent || rr.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected a plain 206, got %d %v", rr.Code, rr.Header())
+	}
+
+	if rr.Body.String() != content[100:] || rr.Header().Get("Content-Range") != fmt.Sprintf("bytes 100-%d/%d", len(content)-1, len(content)) {
+		t.Errorf("wrong range: %v, %d bytes", rr.Header(), rr.Body.Len())
+	}
+
+	// a 206 from a handler that doesn't look at Range either
+	partial := testTools.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-1999/%d", len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte(content[:2000]))
+	}))
+
+	req = httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	partial.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "" || rr.Body.String() != content[:2000] {
+		t.Errorf("partial content should not be compressed, got %v", rr.Header())
+	}
+
+	// the whole file is compressed, without offering ranges of it
+	req = httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Encoding") != "gzip" || rr.Header().Get("Accept-Ranges") != "" {
+		t.Errorf("expected a gzipped 200 without Accept-Ranges, got %d %v", rr.Code, rr.Header())
+	}
+
+	if string(decodeBody(t, rr)) != content {
+		t.Error("wrong body decoded")
+	}
+}
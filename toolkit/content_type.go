@@ -0,0 +1,130 @@
+package toolkit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// UnsupportedMediaTypeError is returned by ReadJSON when RequireJSONContentType
+// is set and the request isn't JSON, or uses a charset we can't read.
+// ErrorJSONResponse answers it with 415 Unsupported Media Type
+type UnsupportedMediaTypeError struct {
+	ContentType string
+	Charset     string
+}
+
+func (e *UnsupportedMediaTypeError) Error() string {
+	if e.Charset != "" {
+		return fmt.Sprintf("unsupported charset %q, body must be UTF-8", e.Charset)
+	}
+
+	if e.ContentType == "" {
+		return "Content-Type header must be application/json"
+	}
+
+	return fmt.Sprintf("unsupported Content-Type %q, must be application/json", e.ContentType)
+}
+
+// tells if the media type is application/json
+// or one of its flavors, like application/problem+json
+func isJSONMediaType(mediaType string, extra ...string) bool {
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		return true
+	}
+
+	for _, x := range extra {
+		if mediaType == x {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checks the Content-Type of the request when RequireJSONContentType is set,
+// and swaps the body for an UTF-8 one if the client sent latin-1 and
+// TranscodeJSONCharset allows it. extra holds other accepted media types
+func (t *Tools) checkJSONContentType(r *http.Request, extra ...string) error {
+	if !t.RequireJSONContentType {
+		return nil
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return &UnsupportedMediaTypeError{}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !isJSONMediaType(mediaType, extra...) {
+		return &UnsupportedMediaTypeError{ContentType: contentType}
+	}
+
+	charset := strings.ToLower(params["charset"])
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii":
+		// ascii is a subset of utf-8, nothing to do
+		return nil
+
+	case "iso-8859-1", "latin1", "latin-1":
+		if t.TranscodeJSONCharset {
+			r.Body = &latin1Reader{src: bufio.NewReader(r.Body), closer: r.Body}
+			return nil
+		}
+	}
+
+	return &UnsupportedMediaTypeError{ContentType: contentType, Charset: charset}
+}
+
+// latin1Reader turns ISO-8859-1 bytes into UTF-8, every byte in
+// latin-1 has the same value as its unicode code point
+type latin1Reader struct {
+	src     *bufio.Reader
+	closer  io.Closer
+	pending []byte
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		// don't block waiting for more if we already have something
+		if n > 0 && len(l.pending) == 0 && l.src.Buffered() == 0 {
+			break
+		}
+
+		if len(l.pending) > 0 {
+			c := copy(p[n:], l.pending)
+			l.pending = l.pending[c:]
+			n += c
+			continue
+		}
+
+		b, err := l.src.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		if b < utf8.RuneSelf {
+			p[n] = b
+			n++
+			continue
+		}
+
+		var buf [utf8.UTFMax]byte
+		size := utf8.EncodeRune(buf[:], rune(b))
+		l.pending = append(l.pending[:0], buf[:size]...)
+	}
+
+	return n, nil
+}
+
+func (l *latin1Reader) Close() error {
+	return l.closer.Close()
+}
@@ -0,0 +1,95 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var contentTypeTests = []struct {
+	testName      string
+	contentType   string
+	body          []byte
+	transcode     bool
+	expected      string
+	errorExpected bool
+}{
+	{testName: "application/json", contentType: "application/json", body: []byte(`{"foo": "bar"}`), expected: "bar"},
+	{testName: "utf-8 charset", contentType: "application/json; charset=UTF-8", body: []byte(`{"foo": "bar"}`), expected: "bar"},
+	{testName: "json suffix", contentType: "application/merge-patch+json", body: []byte(`{"foo": "bar"}`), expected: "bar"},
+	{testName: "missing content type", contentType: "", body: []byte(`{"foo": "bar"}`), errorExpected: true},
+	{testName: "text/plain", contentType: "text/plain", body: []byte(`{"foo": "bar"}`), errorExpected: true},
+	{testName: "form post", contentType: "application/x-www-form-urlencoded", body: []byte(`foo=bar`), errorExpected: true},
+	{testName: "latin-1 rejected", contentType: "application/json; charset=ISO-8859-1", body: []byte("{\"foo\": \"caf\xe9\"}"), errorExpected: true},
+	{testName: "latin-1 transcoded", contentType: "application/json; charset=ISO-8859-1", body: []byte("{\"foo\": \"caf\xe9\"}"), transcode: true, expected: "café"},
+	{testName: "utf-16 rejected", contentType: "application/json; charset=utf-16", body: []byte(`{"foo": "bar"}`), transcode: true, errorExpected: true},
+}
+
+func TestTools_ReadJSON_ContentType(t *testing.T) {
+	for _, e := range contentTypeTests {
+		testTool := Tools{
+			RequireJSONContentType: true,
+			TranscodeJSONCharset:   e.transcode,
+		}
+
+		var decodedJSON struct {
+			Foo string `json:"foo"`
+		}
+
+		req, err := http.NewRequest("POST", "/", bytes.NewReader(e.body))
+		if err != nil {
+			t.Error(err)
+		}
+
+		if e.contentType != "" {
+			req.Header.Set("Content-Type", e.contentType)
+		}
+
+		rr := httptest.NewRecorder()
+
+		err = testTool.ReadJSON(rr, req, &decodedJSON)
+		if e.errorExpected {
+			var mediaTypeError *UnsupportedMediaTypeError
+			if !errors.As(err, &mediaTypeError) {
+				t.Errorf("%s: expected UnsupportedMediaTypeError but got %v", e.testName, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.testName, err.Error())
+		}
+
+		if decodedJSON.Foo != e.expected {
+			t.Errorf("%s: expected %q but got %q", e.testName, e.expected, decodedJSON.Foo)
+		}
+	}
+}
+
+func TestTools_ErrorJSON_UnsupportedMediaType(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+
+	err := testTools.ErrorJSONResponse(rr, &UnsupportedMediaTypeError{ContentType: "text/plain"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("wrong status code returned, expected 415, but got %d", rr.Code)
+	}
+
+	var payload JSONResponse
+	err = json.NewDecoder(rr.Body).Decode(&payload)
+	if err != nil {
+		t.Error("received an error decoding JSON", err)
+	}
+
+	if !payload.Error {
+		t.Error("error set to false in JSON, and it should be true")
+	}
+}
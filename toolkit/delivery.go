@@ -0,0 +1,499 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Delivery is a JSON payload waiting to be sent (or given up on) by a DeliveryQueue
+type Delivery struct {
+	ID            string          `json:"id"`
+	Method        string          `json:"method"`
+	URL           string          `json:"url"`
+	Header        http.Header     `json:"header,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+}
+
+// DeliveryQueue delivers JSON payloads in the background. Every delivery is
+// written to Dir before Enqueue returns, so nothing is lost on a restart:
+// Start picks up whatever was left behind. Deliveries failing MaxAttempts
+// times, or refused by the remote with a 4xx, are moved to a dead letter
+// list that can be inspected with DeadLetters and sent again with Replay
+type DeliveryQueue struct {
+	// where deliveries are stored, in the pending and dead subdirectories
+	Dir string
+	// number of deliveries sent at the same time (default 2)
+	Workers int
+	// attempts before giving up on a delivery (default 5)
+	MaxAttempts int
+	// wait before the first retry, doubled on each one after (default 1s)
+	InitialBackoff time.Duration
+	// the longest wait between attempts (default 5 minutes)
+	MaxBackoff time.Duration
+	// called when a delivery is moved to the dead letters
+	OnDeadLetter func(d Delivery)
+	// called when a pending file can't be read and is moved aside, to
+	// the dead subdirectory with a .corrupt extension. It's logged
+	// through the Tools logger when nil
+	OnCorrupt func(name string, err error)
+
+	tools  *Tools
+	mu     sync.Mutex
+	work   chan string
+	cancel context.CancelFunc
+	ctx    context.Context
+	wg     sync.WaitGroup
+	// ids currently queued or being sent, so nothing is sent twice
+	active map[string]bool
+}
+
+// NewDeliveryQueue creates a queue storing its deliveries in dir and sending
+// them with t, so HTTPClient, RetryPolicy, CircuitBreaker and the rest apply
+func (t *Tools) NewDeliveryQueue(dir string) *DeliveryQueue {
+	return &DeliveryQueue{
+		Dir:   dir,
+		tools: t,
+	}
+}
+
+func (q *DeliveryQueue) pendingDir() string {
+	return filepath.Join(q.Dir, "pending")
+}
+
+func (q *DeliveryQueue) deadDir() string {
+	return filepath.Join(q.Dir, "dead")
+}
+
+func (q *DeliveryQueue) maxAttempts() int {
+	if q.MaxAttempts > 0 {
+		return q.MaxAttempts
+	}
+
+	return 5
+}
+
+func (q *DeliveryQueue) backoff(attempts int) time.Duration {
+	initial := q.InitialBackoff
+	if initial <= 0 {
+		initial = time.Second
+	}
+
+	maxBackoff := q.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Minute
+	}
+
+	d := initial << uint(attempts-1)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+
+	return d
+}
+
+// Start creates the directories, loads the pending deliveries
+// left by a previous run and starts the workers. Pending files that
+// can't be read are moved aside, see OnCorrupt
+func (q *DeliveryQueue) Start() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.cancel != nil {
+		return errors.New("delivery queue already started")
+	}
+
+	if q.tools == nil {
+		q.tools = &Tools{}
+	}
+
+	for _, dir := range []string{q.pendingDir(), q.deadDir()} {
+		// deliveries always live on disk, whatever Tools.FS is
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	pending, corrupt, err := q.list(q.pendingDir())
+	if err != nil {
+		return err
+	}
+
+	for name, err := range corrupt {
+		q.quarantine(name, err)
+	}
+
+	workers := q.Workers
+	if workers <= 0 {
+		workers = 2
+	}
+
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	q.work = make(chan string, 1024)
+	q.active = make(map[string]bool)
+
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+
+	for _, d := range pending {
+		q.scheduleLocked(d)
+	}
+
+	return nil
+}
+
+// Stop stops the workers and waits for them to finish. Deliveries being
+// sent are cancelled and, like everything else pending, kept on disk
+// for the next Start
+func (q *DeliveryQueue) Stop() {
+	q.mu.Lock()
+	cancel := q.cancel
+	q.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	q.wg.Wait()
+
+	q.mu.Lock()
+	q.cancel = nil
+	q.mu.Unlock()
+}
+
+// Enqueue stores a POST of payload to uri and hands it to the workers.
+// If the queue isn't started it's just stored, and sent after Start
+func (q *DeliveryQueue) Enqueue(uri string, payload interface{}, header ...http.Header) (*Delivery, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// ids are file names, so not RandomAlphabet, which could be anything
+	suffix, err := randomString(8, AlphabetAlphanumeric)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	d := &Delivery{
+		ID:            fmt.Sprintf("%d-%s", now.UnixNano(), suffix),
+		Method:        http.MethodPost,
+		URL:           uri,
+		Payload:       data,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+
+	if len(header) > 0 {
+		d.Header = header[0].Clone()
+	}
+
+	if err := os.MkdirAll(q.pendingDir(), 0755); err != nil {
+		return nil, err
+	}
+
+	if err := writeDelivery(q.pendingDir(), d); err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.cancel != nil {
+		q.scheduleLocked(d)
+	}
+
+	return d, nil
+}
+
+// Pending returns the deliveries still waiting to be sent, oldest first.
+// Files that can't be read are left out
+func (q *DeliveryQueue) Pending() ([]*Delivery, error) {
+	deliveries, _, err := q.list(q.pendingDir())
+	return deliveries, err
+}
+
+// DeadLetters returns the deliveries given up on, oldest first.
+// Files that can't be read are left out
+func (q *DeliveryQueue) DeadLetters() ([]*Delivery, error) {
+	deliveries, _, err := q.list(q.deadDir())
+	return deliveries, err
+}
+
+// Replay moves a dead letter back to the pending deliveries,
+// with its attempts reset, and sends it again
+func (q *DeliveryQueue) Replay(id string) error {
+	// ids end up in file paths, anything but a plain name could
+	// reach outside the queue directory
+	if id == "" || filepath.Base(id) != id || strings.HasPrefix(id, ".") {
+		return fmt.Errorf("invalid delivery id %q", id)
+	}
+
+	d, err := readDelivery(filepath.Join(q.deadDir(), id+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("dead letter %q not found", id)
+		}
+		return err
+	}
+
+	d.Attempts = 0
+	d.LastError = ""
+	d.NextAttemptAt = time.Now()
+
+	if err := writeDelivery(q.pendingDir(), d); err != nil {
+		return err
+	}
+
+	if err := os.Remove(filepath.Join(q.deadDir(), id+".json")); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.cancel != nil {
+		q.scheduleLocked(d)
+	}
+
+	return nil
+}
+
+// must be called with the lock held
+func (q *DeliveryQueue) scheduleLocked(d *Delivery) {
+	if q.active[d.ID] {
+		return
+	}
+	q.active[d.ID] = true
+
+	ctx, work := q.ctx, q.work
+
+	// waiting happens on its own goroutine, so a delivery
+	// backing off doesn't hold a worker
+	go func() {
+		if wait := time.Until(d.NextAttemptAt); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		select {
+		case work <- d.ID:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+func (q *DeliveryQueue) worker() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case id := <-q.work:
+			q.deliver(id)
+		}
+	}
+}
+
+func (q *DeliveryQueue) deliver(id string) {
+	path := filepath.Join(q.pendingDir(), id+".json")
+
+	d, err := readDelivery(path)
+	if err != nil {
+		// it's gone, or unreadable and moved aside, nothing left to do
+		if !errors.Is(err, os.ErrNotExist) {
+			q.quarantine(id+".json", err)
+		}
+		q.done(id)
+		return
+	}
+
+	var opts []RequestOption
+	for k, values := range d.Header {
+		for _, v := range values {
+			opts = append(opts, WithHeader(k, v))
+		}
+	}
+
+	_, err = q.tools.SendJSONContext(q.ctx, d.Method, d.URL, d.Payload, nil, opts...)
+
+	if q.ctx.Err() != nil {
+		// we're stopping, this attempt doesn't count
+		return
+	}
+
+	if err == nil {
+		_ = os.Remove(path)
+		q.done(id)
+		return
+	}
+
+	d.Attempts++
+	d.LastError = err.Error()
+
+	// a 4xx means the remote doesn't want it, trying again won't help.
+	// 408 and 429 are the exception, those are about timing
+	var remoteErr *RemoteError
+	permanent := errors.As(err, &remoteErr) &&
+		remoteErr.StatusCode >= 400 && remoteErr.StatusCode < 500 &&
+		remoteErr.StatusCode != http.StatusRequestTimeout && remoteErr.StatusCode != http.StatusTooManyRequests
+
+	if permanent || d.Attempts >= q.maxAttempts() {
+		if writeDelivery(q.deadDir(), d) == nil {
+			_ = os.Remove(path)
+		}
+		q.done(id)
+
+		if q.OnDeadLetter != nil {
+			q.OnDeadLetter(*d)
+		}
+		return
+	}
+
+	d.NextAttemptAt = time.Now().Add(q.backoff(d.Attempts))
+	_ = writeDelivery(q.pendingDir(), d)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.active, id)
+	q.scheduleLocked(d)
+}
+
+// forgets about a delivery that left the pending list. A Replay while
+// it was finishing found it still active and didn't schedule it, so
+// when it's pending again it's scheduled here
+func (q *DeliveryQueue) done(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.active, id)
+
+	if q.cancel == nil || q.ctx.Err() != nil {
+		return
+	}
+
+	if d, err := readDelivery(filepath.Join(q.pendingDir(), id+".json")); err == nil {
+		q.scheduleLocked(d)
+	}
+}
+
+// moves an unreadable pending file to the dead subdirectory, out of the way
+func (q *DeliveryQueue) quarantine(name string, cause error) {
+	err := os.Rename(filepath.Join(q.pendingDir(), name), filepath.Join(q.deadDir(), name+".corrupt"))
+	if err != nil {
+		cause = errors.Join(cause, err)
+	}
+
+	if q.OnCorrupt != nil {
+		q.OnCorrupt(name, cause)
+		return
+	}
+
+	q.tools.logger().Warn("moved aside corrupted delivery",
+		slog.String("name", name),
+		slog.String("error", cause.Error()),
+	)
+}
+
+// the deliveries in dir, and the names of the files that couldn't be read
+func (q *DeliveryQueue) list(dir string) ([]*Delivery, map[string]error, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	var deliveries []*Delivery
+	corrupt := make(map[string]error)
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		d, err := readDelivery(filepath.Join(dir, entry.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			// delivered while we were listing
+			continue
+		}
+		if err != nil {
+			corrupt[entry.Name()] = err
+			continue
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+	})
+
+	return deliveries, corrupt, nil
+}
+
+func readDelivery(path string) (*Delivery, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var d Delivery
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("corrupted delivery %s: %w", filepath.Base(path), err)
+	}
+
+	return &d, nil
+}
+
+// writes to a temporary file first and renames it, so a crash
+// in the middle never leaves half a delivery behind
+func writeDelivery(dir string, d *Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".delivery-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(dir, d.ID+".json"))
+}
@@ -0,0 +1,302 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a remote that answers with the given status, and keeps what it received
+type testRemote struct {
+	mu       sync.Mutex
+	status   int
+	received []string
+	headers  []string
+}
+
+func (r *testRemote) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var payload struct {
+		Foo string `json:"foo"`
+	}
+	_ = json.NewDecoder(req.Body).Decode(&payload)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.received = append(r.received, payload.Foo)
+	r.headers = append(r.headers, req.Header.Get("X-Event"))
+	w.WriteHeader(r.status)
+}
+
+func (r *testRemote) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status = status
+}
+
+func (r *testRemote) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.received)
+}
+
+// waits until cond is true, or fails the test
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeliveryQueue_Deliver(t *testing.T) {
+	remote := &testRemote{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(remote)
+	defer server.Close()
+
+	var testTools Tools
+
+	queue := testTools.NewDeliveryQueue(t.TempDir())
+	queue.InitialBackoff = 10 * time.Millisecond
+
+	if err := queue.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Stop()
+
+	_, err := queue.Enqueue(server.URL, map[string]string{"foo": "bar"}, http.Header{"X-Event": []string{"created"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fails a couple of times, and then the remote comes back
+	eventually(t, "two failed attempts", func() bool { return remote.count() >= 2 })
+	remote.setStatus(http.StatusOK)
+
+	eventually(t, "the delivery", func() bool {
+		pending, _ := queue.Pending()
+		return len(pending) == 0
+	})
+
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+
+	last := len(remote.received) - 1
+	if remote.received[last] != "bar" || remote.headers[last] != "created" {
+		t.Errorf("wrong delivery received: %s %s", remote.received[last], remote.headers[last])
+	}
+}
+
+func TestDeliveryQueue_DeadLetters(t *testing.T) {
+	remote := &testRemote{status: http.StatusInternalServerError}
+	server := httptest.NewServer(remote)
+	defer server.Close()
+
+	var testTools Tools
+
+	var dead []Delivery
+	var mu sync.Mutex
+
+	queue := testTools.NewDeliveryQueue(t.TempDir())
+	queue.MaxAttempts = 3
+	queue.InitialBackoff = time.Millisecond
+	queue.OnDeadLetter = func(d Delivery) {
+		mu.Lock()
+		defer mu.Unlock()
+		dead = append(dead, d)
+	}
+
+	if err := queue.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Stop()
+
+	d, err := queue.Enqueue(server.URL, map[string]string{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// called once the delivery is done with
+	eventually(t, "the dead letter", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(dead) == 1
+	})
+
+	if remote.count() != 3 {
+		t.Errorf("expected 3 attempts but got %d", remote.count())
+	}
+
+	letters, _ := queue.DeadLetters()
+	if len(letters) != 1 || letters[0].ID != d.ID || letters[0].Attempts != 3 || letters[0].LastError == "" {
+		t.Fatalf("wrong dead letters: %+v", letters)
+	}
+
+	// replaying it once the remote is fixed delivers it
+	remote.setStatus(http.StatusOK)
+
+	if err := queue.Replay(d.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "the replayed delivery", func() bool {
+		pending, _ := queue.Pending()
+		letters, _ := queue.DeadLetters()
+		return len(pending) == 0 && len(letters) == 0
+	})
+
+	if err := queue.Replay("nope"); err == nil {
+		t.Error("replaying an unknown dead letter should fail")
+	}
+
+	// ids are file names, nothing outside the queue is touched
+	victim := filepath.Join(filepath.Dir(queue.Dir), "victim.json")
+	_ = os.WriteFile(victim, []byte(`{"id":"victim"}`), 0644)
+
+	for _, id := range []string{"../../victim", "../victim", "/victim", ".", ""} {
+		if err := queue.Replay(id); err == nil {
+			t.Errorf("replaying %q should fail", id)
+		}
+	}
+
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("a file outside the queue was touched: %v", err)
+	}
+}
+
+func TestDeliveryQueue_Rejected(t *testing.T) {
+	remote := &testRemote{status: http.StatusBadRequest}
+	server := httptest.NewServer(remote)
+	defer server.Close()
+
+	var testTools Tools
+
+	queue := testTools.NewDeliveryQueue(t.TempDir())
+	queue.InitialBackoff = time.Millisecond
+
+	if err := queue.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Stop()
+
+	if _, err := queue.Enqueue(server.URL, map[string]string{"foo": "bar"}); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "the dead letter", func() bool {
+		letters, _ := queue.DeadLetters()
+		return len(letters) == 1
+	})
+
+	if remote.count() != 1 {
+		t.Errorf("a 4xx should not be retried, got %d attempts", remote.count())
+	}
+}
+
+func TestDeliveryQueue_ReplayWhileFinishing(t *testing.T) {
+	remote := &testRemote{status: http.StatusBadRequest}
+	server := httptest.NewServer(remote)
+	defer server.Close()
+
+	var testTools Tools
+
+	queue := testTools.NewDeliveryQueue(t.TempDir())
+	queue.InitialBackoff = time.Millisecond
+
+	if err := queue.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Stop()
+
+	d, err := queue.Enqueue(server.URL, map[string]string{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "the dead letter", func() bool {
+		letters, _ := queue.DeadLetters()
+		return len(letters) == 1
+	})
+
+	// replayed in the window where the worker is still finishing with it
+	queue.mu.Lock()
+	queue.active[d.ID] = true
+	queue.mu.Unlock()
+
+	remote.setStatus(http.StatusOK)
+
+	if err := queue.Replay(d.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	queue.done(d.ID)
+
+	eventually(t, "the replayed delivery", func() bool {
+		pending, _ := queue.Pending()
+		return len(pending) == 0 && remote.count() == 2
+	})
+}
+
+func TestDeliveryQueue_Persistence(t *testing.T) {
+	remote := &testRemote{status: http.StatusOK}
+	server := httptest.NewServer(remote)
+	defer server.Close()
+
+	var testTools Tools
+	dir := t.TempDir()
+
+	// stored while nothing is running, like before a restart
+	stopped := testTools.NewDeliveryQueue(dir)
+	for _, foo := range []string{"one", "two"} {
+		if _, err := stopped.Enqueue(server.URL, map[string]string{"foo": foo}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, err := stopped.Pending()
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("expected 2 pending deliveries but got %d (%v)", len(pending), err)
+	}
+
+	if remote.count() != 0 {
+		t.Fatal("nothing should be sent before Start")
+	}
+
+	// a truncated one, like after a full disk, doesn't stop the rest
+	_ = os.WriteFile(filepath.Join(dir, "pending", "bad.json"), []byte(`{"id":"ba`), 0644)
+
+	var corrupt []string
+	queue := testTools.NewDeliveryQueue(dir)
+	queue.OnCorrupt = func(name string, err error) {
+		corrupt = append(corrupt, name)
+	}
+
+	if err := queue.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Stop()
+
+	if len(corrupt) != 1 || corrupt[0] != "bad.json" {
+		t.Errorf("expected bad.json reported, got %v", corrupt)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "dead", "bad.json.corrupt")); err != nil {
+		t.Errorf("the corrupted file should be moved aside: %v", err)
+	}
+
+	eventually(t, "the deliveries", func() bool {
+		pending, _ := queue.Pending()
+		return len(pending) == 0 && remote.count() == 2
+	})
+}
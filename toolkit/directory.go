@@ -0,0 +1,403 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DirectoryEntry describes a file or directory returned by ListDirectory
+type DirectoryEntry struct {
+	Name string `json:"name"`
+	// relative to the listed root, with forward slashes
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+	// detected from the first 512 bytes, like UploadFiles does
+	ContentType string `json:"content_type,omitempty"`
+	// sha256 of the content in hex, only with ListOptions.Checksum
+	Checksum string `json:"checksum,omitempty"`
+
+	// a regular file, with content to sniff and sum
+	regular bool
+}
+
+// ListOptions filter, sort and paginate ListDirectory
+type ListOptions struct {
+	// glob matched against names, like "*.png"
+	Pattern string
+	// content types to keep, like "image/png" or "image/*". Directories
+	// have no content type, so they're left out when this is set
+	Types []string
+	// "name" (default), "size", "mod_time" or "type",
+	// directories always come first
+	SortBy     string
+	Descending bool
+	// computes Checksum for the files in the page
+	Checksum bool
+	// includes names starting with a dot
+	Hidden bool
+	// the page wanted, everything when PerPage is 0
+	Page Pagination
+}
+
+// ListDirectory lists dir, a path inside root that can't lead out of it,
+// returning the entries in the requested page and how many there are
+// in total. Files are only opened for the page, unless Types or sorting
+// by type need the content type of all of them
+func (t *Tools) ListDirectory(root, dir string, options ListOptions) ([]DirectoryEntry, int, error) {
+	full, err := t.jailPath(root, dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// a bad pattern should fail even on an empty directory
+	if _, err := path.Match(options.Pattern, ""); err != nil {
+		return nil, 0, fmt.Errorf("invalid pattern %q", options.Pattern)
+	}
+
+	entries, err := t.fs().ReadDir(full)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rel, _ := filepath.Rel(filepath.Clean(root), full)
+
+	// sniffing opens the file, only do it for every one when we must
+	sniffAll := len(options.Types) > 0 || options.SortBy == "type"
+
+	var listed []DirectoryEntry
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if !options.Hidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if options.Pattern != "" {
+			if ok, _ := path.Match(options.Pattern, name); !ok {
+				continue
+			}
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		e := DirectoryEntry{
+			Name:    name,
+			Path:    path.Join(filepath.ToSlash(rel), name),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+			regular: info.Mode().IsRegular(),
+		}
+
+		if e.IsDir {
+			e.Size = 0
+		}
+
+		if e.regular && sniffAll {
+			if e.ContentType, err = t.detectContentType(filepath.Join(full, name)); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if len(options.Types) > 0 && !matchesContentType(e.ContentType, options.Types) {
+			continue
+		}
+
+		listed = append(listed, e)
+	}
+
+	sortDirectoryEntries(listed, options.SortBy, options.Descending)
+
+	total := len(listed)
+
+	if options.Page.PerPage > 0 {
+		start := options.Page.Offset()
+		if start > total {
+			start = total
+		}
+
+		end := start + options.Page.PerPage
+		if end > total {
+			end = total
+		}
+
+		listed = listed[start:end]
+	}
+
+	for i := range listed {
+		if !listed[i].regular {
+			continue
+		}
+
+		if !sniffAll {
+			if listed[i].ContentType, err = t.detectContentType(filepath.Join(full, listed[i].Name)); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if options.Checksum {
+			if listed[i].Checksum, err = t.fileChecksum(filepath.Join(full, listed[i].Name)); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	if listed == nil {
+		listed = []DirectoryEntry{}
+	}
+
+	return listed, total, nil
+}
+
+// sniffs the content, like UploadFiles, falling back to the extension
+// for what sniffing can't tell apart, like css or json
+func (t *Tools) detectContentType(name string) (string, error) {
+	f, err := t.fs().Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buff := make([]byte, 512)
+	n, err := io.ReadFull(f, buff)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	contentType := http.DetectContentType(buff[:n])
+
+	if contentType == "application/octet-stream" || strings.HasPrefix(contentType, "text/plain") {
+		if byExtension := mime.TypeByExtension(filepath.Ext(name)); byExtension != "" {
+			contentType = byExtension
+		}
+	}
+
+	return contentType, nil
+}
+
+func (t *Tools) fileChecksum(name string) (string, error) {
+	f, err := t.fs().Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// tells if contentType is one of types, which may end in "/*"
+func matchesContentType(contentType string, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortDirectoryEntries(entries []DirectoryEntry, sortBy string, descending bool) {
+	less := func(a, b DirectoryEntry) bool {
+		switch sortBy {
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case "mod_time":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		case "type":
+			if a.ContentType != b.ContentType {
+				return a.ContentType < b.ContentType
+			}
+		}
+		return a.Name < b.Name
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+
+		if descending {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+}
+
+// DirectoryPage is what the DirectoryTemplate gets to render
+type DirectoryPage struct {
+	// the listed path, relative to the root
+	Path string
+	// the parent path, empty at the root
+	Parent  string
+	Entries []DirectoryEntry
+	Page    int
+	PerPage int
+	Total   int
+	// where files are linked to, their Path is added to it
+	FileBaseURL string
+}
+
+// the listing ServeDirectory renders for browsers when Tools.DirectoryTemplate isn't set
+var defaultDirectoryTemplate = template.Must(template.New("directory").Funcs(template.FuncMap{
+	"query": func(p string) string { return "?path=" + template.URLQueryEscaper(p) },
+}).Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>/{{.Path}}</title></head>
+<body>
+<h1>/{{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th><th>Type</th></tr>
+{{if .Parent}}<tr><td><a href="{{query .Parent}}">..</a></td><td></td><td></td><td></td></tr>
+{{else if .Path}}<tr><td><a href="?">..</a></td><td></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr>
+<td>{{if .IsDir}}<a href="{{query .Path}}">{{.Name}}/</a>{{else if $.FileBaseURL}}<a href="{{$.FileBaseURL}}{{.Path}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td>
+<td>{{if not .IsDir}}{{.Size}}{{end}}</td>
+<td>{{.ModTime.Format "2006-01-02 15:04:05"}}</td>
+<td>{{.ContentType}}</td>
+</tr>
+{{end}}</table>
+{{if .PerPage}}<p>page {{.Page}}, {{.Total}} entries</p>{{end}}
+</body>
+</html>
+`))
+
+// ServeDirectory lists a directory inside root for a file browser endpoint.
+// The query string picks what's listed: path, pattern, type (repeatable),
+// sort, order=desc, checksum=true, hidden=true, page and per_page. Browsers
+// asking for text/html get DirectoryTemplate, linking files to fileBaseURL
+// when given, everybody else gets JSON through WritePaginatedJSON. Errors
+// are answered through ErrorJSONResponse and returned
+func (t *Tools) ServeDirectory(w http.ResponseWriter, r *http.Request, root string, fileBaseURL ...string) error {
+	query := r.URL.Query()
+
+	page, err := t.ReadPagination(r)
+	if err != nil {
+		_ = t.ErrorJSONResponse(w, err)
+		return err
+	}
+
+	options := ListOptions{
+		Pattern:    query.Get("pattern"),
+		Types:      query["type"],
+		SortBy:     query.Get("sort"),
+		Descending: query.Get("order") == "desc",
+		Page:       page,
+	}
+
+	switch options.SortBy {
+	case "", "name", "size", "mod_time", "type":
+	default:
+		err := fmt.Errorf("can't sort by %q", options.SortBy)
+		_ = t.ErrorJSONResponse(w, err)
+		return err
+	}
+
+	flags := []struct {
+		param string
+		value *bool
+	}{
+		{param: "checksum", value: &options.Checksum},
+		{param: "hidden", value: &options.Hidden},
+	}
+
+	for _, flag := range flags {
+		if s := query.Get(flag.param); s != "" {
+			if *flag.value, err = strconv.ParseBool(s); err != nil {
+				err = fmt.Errorf("%s must be true or false", flag.param)
+				_ = t.ErrorJSONResponse(w, err)
+				return err
+			}
+		}
+	}
+
+	dir := path.Clean("/" + query.Get("path"))
+
+	entries, total, err := t.ListDirectory(root, dir, options)
+	if err != nil {
+		_ = t.ErrorJSONResponse(w, err)
+		return err
+	}
+
+	if !prefersHTML(r) {
+		return t.WritePaginatedJSON(w, r, http.StatusOK, PaginatedResponse{
+			Items:   entries,
+			Page:    page.Page,
+			PerPage: page.PerPage,
+			Total:   total,
+		})
+	}
+
+	data := DirectoryPage{
+		Path:    strings.TrimPrefix(dir, "/"),
+		Entries: entries,
+		Page:    page.Page,
+		PerPage: page.PerPage,
+		Total:   total,
+	}
+
+	if parent := path.Dir(dir); dir != "/" && parent != "/" {
+		data.Parent = strings.TrimPrefix(parent, "/")
+	}
+
+	if len(fileBaseURL) > 0 {
+		data.FileBaseURL = strings.TrimSuffix(fileBaseURL[0], "/") + "/"
+	}
+
+	tmpl := t.DirectoryTemplate
+	if tmpl == nil {
+		tmpl = defaultDirectoryTemplate
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	return tmpl.Execute(w, data)
+}
+
+// tells if the Accept header asks for html before json, like browsers do
+func prefersHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+
+	htmlAt := strings.Index(accept, "text/html")
+	if htmlAt < 0 {
+		return false
+	}
+
+	jsonAt := strings.Index(accept, "application/json")
+
+	return jsonAt < 0 || htmlAt < jsonAt
+}
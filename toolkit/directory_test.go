@@ -0,0 +1,205 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a small file tree to list, files are older the further down they are
+func testTree(t *testing.T) *MemFS {
+	t.Helper()
+
+	var img strings.Builder
+	_ = png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+
+	memFS := NewMemFS()
+	_ = memFS.MkdirAll("/root/photos", 0755)
+	_ = memFS.MkdirAll("/outside", 0755)
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{name: "/root/b.png", content: img.String()},
+		{name: "/root/a.txt", content: "hello world, a longer text file"},
+		{name: "/root/c.json", content: `{"foo":"bar"}`},
+		{name: "/root/.hidden", content: "secret"},
+		{name: "/root/photos/d.png", content: img.String()},
+		{name: "/outside/secret.txt", content: "secret"},
+	}
+
+	for i, f := range files {
+		if err := memFS.WriteFile(f.name, []byte(f.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_ = memFS.Chtimes(f.name, time.Now().Add(-time.Duration(i)*time.Hour))
+	}
+
+	return memFS
+}
+
+func entryNames(entries []DirectoryEntry) string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+var listDirectoryTests = []struct {
+	testName string
+	dir      string
+	options  ListOptions
+	expected string
+	total    int
+}{
+	{testName: "defaults", dir: "/", expected: "photos,a.txt,b.png,c.json", total: 4},
+	{testName: "hidden", dir: "", options: ListOptions{Hidden: true}, expected: "photos,.hidden,a.txt,b.png,c.json", total: 5},
+	{testName: "pattern", dir: "/", options: ListOptions{Pattern: "*.png"}, expected: "b.png", total: 1},
+	{testName: "type", dir: "/", options: ListOptions{Types: []string{"image/*", "application/json"}}, expected: "b.png,c.json", total: 2},
+	{testName: "sort by size", dir: "/", options: ListOptions{SortBy: "size"}, expected: "photos,c.json,a.txt,b.png", total: 4},
+	{testName: "sort by time descending", dir: "/", options: ListOptions{SortBy: "mod_time", Descending: true}, expected: "photos,b.png,a.txt,c.json", total: 4},
+	{testName: "page", dir: "/", options: ListOptions{Page: Pagination{Page: 2, PerPage: 3}}, expected: "c.json", total: 4},
+	{testName: "page past the end", dir: "/", options: ListOptions{Page: Pagination{Page: 9, PerPage: 3}}, expected: "", total: 4},
+	{testName: "subdirectory", dir: "photos", expected: "d.png", total: 1},
+}
+
+func TestTools_ListDirectory(t *testing.T) {
+	testTools := Tools{FS: testTree(t)}
+
+	for _, e := range listDirectoryTests {
+		entries, total, err := testTools.ListDirectory("/root", e.dir, e.options)
+		if err != nil {
+			t.Errorf("%s: %v", e.testName, err)
+			continue
+		}
+
+		if entryNames(entries) != e.expected || total != e.total {
+			t.Errorf("%s: expected %s (%d) but got %s (%d)", e.testName, e.expected, e.total, entryNames(entries), total)
+		}
+	}
+
+	entries, _, _ := testTools.ListDirectory("/root", "photos", ListOptions{Checksum: true})
+	if entries[0].Path != "photos/d.png" || entries[0].ContentType != "image/png" || len(entries[0].Checksum) != 64 {
+		t.Errorf("wrong entry: %+v", entries[0])
+	}
+
+	if _, _, err := testTools.ListDirectory("/root", "../outside", ListOptions{}); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("listing outside the root should fail, got %v", err)
+	}
+
+	if _, _, err := testTools.ListDirectory("/root", "/", ListOptions{Pattern: "[a-"}); err == nil {
+		t.Error("a bad pattern should fail")
+	}
+}
+
+func TestTools_ServeDirectory(t *testing.T) {
+	testTools := Tools{FS: testTree(t)}
+
+	// json by default
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/list?sort=size&per_page=2", nil)
+
+	if err := testTools.ServeDirectory(rr, req, "/root"); err != nil {
+		t.Fatal(err)
+	}
+
+	var page struct {
+		Items []DirectoryEntry `json:"items"`
+		Total int              `json:"total"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+
+	if entryNames(page.Items) != "photos,c.json" || page.Total != 4 {
+		t.Errorf("wrong json listing: %+v", page)
+	}
+
+	if !strings.Contains(rr.Header().Get("Link"), `rel="next"`) {
+		t.Errorf("expected a link to the next page, got %s", rr.Header().Get("Link"))
+	}
+
+	// html for browsers
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/list?path=photos", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+
+	if err := testTools.ServeDirectory(rr, req, "/root", "/files"); err != nil {
+		t.Fatal(err)
+	}
+
+	body := rr.Body.String()
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") || !strings.Contains(body, `href="/files/photos/d.png"`) {
+		t.Errorf("wrong html listing: %s", body)
+	}
+
+	// errors
+	errorTests := []struct {
+		query  string
+		status int
+	}{
+		// cleaned to /outside inside the root, which doesn't exist
+		{query: "path=../outside", status: http.StatusNotFound},
+		{query: "path=nope", status: http.StatusNotFound},
+		{query: "sort=color", status: http.StatusBadRequest},
+		{query: "checksum=maybe", status: http.StatusBadRequest},
+	}
+
+	for _, e := range errorTests {
+		rr = httptest.NewRecorder()
+		err := testTools.ServeDirectory(rr, httptest.NewRequest(http.MethodGet, "/list?"+e.query, nil), "/root")
+
+		if rr.Code != e.status || err == nil || errorStatus(err) != e.status {
+			t.Errorf("%s: expected status %d but got %d (%v)", e.query, e.status, rr.Code, err)
+		}
+	}
+}
+
+// counts the files opened
+type openCountingFS struct {
+	FileSystem
+	opened []string
+}
+
+func (c *openCountingFS) Open(name string) (fs.File, error) {
+	c.opened = append(c.opened, name)
+	return c.FileSystem.Open(name)
+}
+
+func TestTools_ListDirectorySniffing(t *testing.T) {
+	counting := &openCountingFS{FileSystem: testTree(t)}
+	testTools := Tools{FS: counting}
+
+	// only the page is opened
+	entries, _, err := testTools.ListDirectory("/root", "/", ListOptions{Page: Pagination{Page: 1, PerPage: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entryNames(entries) != "photos,a.txt" || entries[1].ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("wrong page: %+v", entries)
+	}
+
+	if strings.Join(counting.opened, ",") != "/root/a.txt" {
+		t.Errorf("expected only a.txt opened, got %v", counting.opened)
+	}
+
+	// filtering by type needs them all
+	counting.opened = nil
+	if _, _, err := testTools.ListDirectory("/root", "/", ListOptions{Types: []string{"image/*"}, Page: Pagination{Page: 1, PerPage: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(counting.opened) != 3 {
+		t.Errorf("expected every file opened, got %v", counting.opened)
+	}
+}
@@ -0,0 +1,218 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideRoot is returned when a path escapes the root directory it's jailed to
+var ErrOutsideRoot = errors.New("path is outside the root directory")
+
+// FileSystem is what the directory helpers and UploadFiles need from a
+// filesystem. OSFileSystem is the real one, used when Tools.FS is nil,
+// and MemFS keeps everything in memory for tests
+type FileSystem interface {
+	Open(name string) (fs.File, error)
+	Create(name string) (io.WriteCloser, error)
+	Stat(name string) (fs.FileInfo, error)
+	// like Stat, but a symlink is described and not followed
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(path string, perm fs.FileMode) error
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Remove(name string) error
+}
+
+// OSFileSystem is the operating system filesystem
+type OSFileSystem struct{}
+
+func (OSFileSystem) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (OSFileSystem) Create(name string) (io.WriteCloser, error) { return os.Create(name) }
+func (OSFileSystem) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (OSFileSystem) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (OSFileSystem) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (OSFileSystem) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+func (OSFileSystem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+func (OSFileSystem) Remove(name string) error { return os.Remove(name) }
+
+func (t *Tools) fs() FileSystem {
+	if t.FS != nil {
+		return t.FS
+	}
+
+	return OSFileSystem{}
+}
+
+// Creates a directory if not exists
+// and all necessary parents, with mode
+// (default 0755). It fails if path exists
+// but isn't a directory
+func (t *Tools) CreateDirIfNotExists(path string, mode ...fs.FileMode) error {
+	perm := fs.FileMode(0755)
+	if len(mode) > 0 {
+		perm = mode[0]
+	}
+
+	info, err := t.fs().Stat(path)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s exists and is not a directory", path)
+		}
+		return nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return t.fs().MkdirAll(path, perm)
+}
+
+// EnsureWritable creates the directory if needed and checks
+// a file can be written in it, by writing and removing one
+func (t *Tools) EnsureWritable(path string) error {
+	if err := t.CreateDirIfNotExists(path); err != nil {
+		return err
+	}
+
+	// not RandomAlphabet, which may have path separators
+	probeName, err := randomString(10, AlphabetAlphanumeric)
+	if err != nil {
+		return err
+	}
+
+	probe := filepath.Join(path, ".write-test-"+probeName)
+
+	if err := t.fs().WriteFile(probe, nil, 0600); err != nil {
+		return fmt.Errorf("directory %s is not writable: %w", path, err)
+	}
+
+	return t.fs().Remove(probe)
+}
+
+// jailPath joins name to root, failing with ErrOutsideRoot if the result
+// is outside it, through ".." or a symlink on the way. name may be absolute,
+// it's still taken as relative to root
+func (t *Tools) jailPath(root, name string) (string, error) {
+	root = filepath.Clean(root)
+
+	full := filepath.Join(root, filepath.FromSlash(name))
+
+	rel, err := filepath.Rel(root, full)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideRoot, name)
+	}
+
+	if rel == "." {
+		return full, nil
+	}
+
+	// a symlink anywhere below root could lead out of it, the last
+	// part included, since callers read or remove what it points to
+	current := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+
+		info, err := t.fs().Lstat(current)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("%w: %s is a symlink", ErrOutsideRoot, name)
+		}
+	}
+
+	return full, nil
+}
+
+// RemoveAllJailed removes name, and everything in it, from inside root.
+// It refuses to remove root itself or anything outside it, and symlinks
+// found inside are removed without touching what they point to
+func (t *Tools) RemoveAllJailed(root, name string) error {
+	full, err := t.jailPath(root, name)
+	if err != nil {
+		return err
+	}
+
+	if full == filepath.Clean(root) {
+		return errors.New("refusing to remove the root directory")
+	}
+
+	info, err := t.fs().Lstat(full)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	return t.removeAll(full, info)
+}
+
+func (t *Tools) removeAll(path string, info fs.FileInfo) error {
+	if info.IsDir() {
+		entries, err := t.fs().ReadDir(path)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			// entries describe symlinks without following them
+			entryInfo, err := entry.Info()
+			if err != nil {
+				return err
+			}
+
+			if err := t.removeAll(filepath.Join(path, entry.Name()), entryInfo); err != nil {
+				return err
+			}
+		}
+	}
+
+	return t.fs().Remove(path)
+}
+
+// DirSize returns the size in bytes of the files in path and its
+// subdirectories, symlinks are not followed
+func (t *Tools) DirSize(path string) (int64, error) {
+	entries, err := t.fs().ReadDir(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirSize, err := t.DirSize(filepath.Join(path, entry.Name()))
+			if err != nil {
+				return 0, err
+			}
+			size += dirSize
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return 0, err
+		}
+
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+	}
+
+	return size, nil
+}
@@ -0,0 +1,192 @@
+package toolkit
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// the same checks run on the real filesystem and on MemFS
+var fileSystems = []struct {
+	testName string
+	fs       func(t *testing.T) (FileSystem, string)
+}{
+	{testName: "os", fs: func(t *testing.T) (FileSystem, string) { return OSFileSystem{}, t.TempDir() }},
+	{testName: "memory", fs: func(t *testing.T) (FileSystem, string) { return NewMemFS(), "/data" }},
+}
+
+func TestTools_CreateDirIfNotExistsFS(t *testing.T) {
+	for _, e := range fileSystems {
+		fsys, root := e.fs(t)
+		testTools := Tools{FS: fsys}
+
+		dir := filepath.Join(root, "a", "b")
+
+		if err := testTools.CreateDirIfNotExists(dir, 0700); err != nil {
+			t.Fatalf("%s: %v", e.testName, err)
+		}
+
+		info, err := fsys.Stat(dir)
+		if err != nil || !info.IsDir() || info.Mode().Perm() != 0700 {
+			t.Errorf("%s: wrong directory created: %v %v", e.testName, info, err)
+		}
+
+		// already there
+		if err := testTools.CreateDirIfNotExists(dir); err != nil {
+			t.Errorf("%s: %v", e.testName, err)
+		}
+
+		file := filepath.Join(root, "file.txt")
+		if err := fsys.WriteFile(file, []byte("hello"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := testTools.CreateDirIfNotExists(file); err == nil {
+			t.Errorf("%s: a file where the directory should be must fail", e.testName)
+		}
+	}
+}
+
+func TestTools_EnsureWritable(t *testing.T) {
+	for _, e := range fileSystems {
+		fsys, root := e.fs(t)
+		testTools := Tools{FS: fsys}
+
+		dir := filepath.Join(root, "uploads")
+
+		if err := testTools.EnsureWritable(dir); err != nil {
+			t.Errorf("%s: %v", e.testName, err)
+		}
+
+		// the probe is gone
+		entries, _ := fsys.ReadDir(dir)
+		if len(entries) != 0 {
+			t.Errorf("%s: expected an empty directory but got %d entries", e.testName, len(entries))
+		}
+	}
+
+	// root can write anywhere, so this one is only checked in memory
+	memFS := NewMemFS()
+	testTools := Tools{FS: memFS}
+
+	_ = memFS.MkdirAll("/readonly", 0555)
+	if err := testTools.EnsureWritable("/readonly"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected a permission error but got %v", err)
+	}
+}
+
+func TestTools_RemoveAllJailed(t *testing.T) {
+	for _, e := range fileSystems {
+		fsys, root := e.fs(t)
+		testTools := Tools{FS: fsys}
+
+		_ = fsys.MkdirAll(filepath.Join(root, "cache", "deep", "er"), 0755)
+		_ = fsys.WriteFile(filepath.Join(root, "cache", "a.txt"), []byte("a"), 0644)
+		_ = fsys.WriteFile(filepath.Join(root, "cache", "deep", "er", "b.txt"), []byte("b"), 0644)
+		_ = fsys.WriteFile(filepath.Join(root, "keep.txt"), []byte("keep"), 0644)
+
+		for _, name := range []string{"../etc", "cache/../../etc", ".", ""} {
+			if err := testTools.RemoveAllJailed(root, name); err == nil {
+				t.Errorf("%s: removing %q should fail", e.testName, name)
+			}
+		}
+
+		if err := testTools.RemoveAllJailed(root, "/cache"); err != nil {
+			t.Fatalf("%s: %v", e.testName, err)
+		}
+
+		if _, err := fsys.Stat(filepath.Join(root, "cache")); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: cache should be gone", e.testName)
+		}
+
+		if _, err := fsys.Stat(filepath.Join(root, "keep.txt")); err != nil {
+			t.Errorf("%s: keep.txt should still be there", e.testName)
+		}
+
+		// nothing to remove is fine
+		if err := testTools.RemoveAllJailed(root, "cache"); err != nil {
+			t.Errorf("%s: %v", e.testName, err)
+		}
+	}
+}
+
+func TestTools_RemoveAllJailedSymlinks(t *testing.T) {
+	var testTools Tools
+
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	_ = os.WriteFile(filepath.Join(outside, "precious.txt"), []byte("precious"), 0644)
+	_ = os.MkdirAll(filepath.Join(root, "dir"), 0755)
+
+	if err := os.Symlink(outside, filepath.Join(root, "dir", "link")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	// can't go through the link
+	if err := testTools.RemoveAllJailed(root, "dir/link/precious.txt"); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("expected ErrOutsideRoot but got %v", err)
+	}
+
+	// removing the directory only removes the link
+	if err := testTools.RemoveAllJailed(root, "dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "precious.txt")); err != nil {
+		t.Error("the symlink target should not be touched")
+	}
+}
+
+func TestTools_DirSize(t *testing.T) {
+	for _, e := range fileSystems {
+		fsys, root := e.fs(t)
+		testTools := Tools{FS: fsys}
+
+		_ = fsys.MkdirAll(filepath.Join(root, "sub"), 0755)
+		_ = fsys.WriteFile(filepath.Join(root, "a.txt"), make([]byte, 100), 0644)
+		_ = fsys.WriteFile(filepath.Join(root, "sub", "b.txt"), make([]byte, 50), 0644)
+
+		size, err := testTools.DirSize(root)
+		if err != nil || size != 150 {
+			t.Errorf("%s: expected 150 bytes but got %d (%v)", e.testName, size, err)
+		}
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	memFS := NewMemFS()
+
+	if err := memFS.WriteFile("/missing/file.txt", nil, 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("writing without the directory should fail, got %v", err)
+	}
+
+	_ = memFS.MkdirAll("/dir", 0755)
+
+	w, err := memFS.Create("/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(w, "hello")
+	_ = w.Close()
+
+	f, err := memFS.Open("/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	if string(data) != "hello" {
+		t.Errorf("wrong content read: %s", data)
+	}
+
+	if err := memFS.Remove("/dir"); err == nil {
+		t.Error("removing a directory with files should fail")
+	}
+
+	if err := memFS.MkdirAll("/dir/file.txt/sub", 0755); err == nil {
+		t.Error("a directory inside a file should fail")
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/kcalixto/go-module/toolkit
 
-go 1.20
+go 1.22
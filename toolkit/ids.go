@@ -0,0 +1,327 @@
+package toolkit
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UUID is a RFC 9562 universally unique identifier
+type UUID [16]byte
+
+// String returns the canonical form, like "0189c8a2-7d3e-7b1a-9f3c-2a4b6c8d0e1f"
+func (u UUID) String() string {
+	var buf [36]byte
+
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+
+	return string(buf[:])
+}
+
+// Version is the UUID version, 4 or 7 for the ones we make
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// Time is when a version 7 UUID was created, with millisecond precision
+func (u UUID) Time() time.Time {
+	if u.Version() != 7 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(int64(readUint48(u[0:6])))
+}
+
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+func (u *UUID) UnmarshalText(text []byte) error {
+	var t Tools
+
+	parsed, err := t.ParseUUID(string(text))
+	if err != nil {
+		return err
+	}
+
+	*u = parsed
+	return nil
+}
+
+// ULID is a universally unique lexicographically sortable identifier,
+// 48 bits of milliseconds followed by 80 random bits
+type ULID [16]byte
+
+// String returns the 26 characters Crockford base32 form
+func (u ULID) String() string {
+	var buf [26]byte
+
+	// 128 bits don't split evenly in 5 bit characters, so the first one
+	// only gets 3 bits, that's why a ULID never starts above '7'
+	var carry uint
+	var bitCount uint
+	pos := len(buf) - 1
+
+	for i := len(u) - 1; i >= 0; i-- {
+		carry |= uint(u[i]) << bitCount
+		bitCount += 8
+
+		for bitCount >= 5 {
+			buf[pos] = AlphabetCrockford[carry&31]
+			pos--
+			carry >>= 5
+			bitCount -= 5
+		}
+	}
+
+	buf[0] = AlphabetCrockford[carry&31]
+
+	return string(buf[:])
+}
+
+// Time is when the ULID was created, with millisecond precision
+func (u ULID) Time() time.Time {
+	return time.UnixMilli(int64(readUint48(u[0:6])))
+}
+
+func (u ULID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+func (u *ULID) UnmarshalText(text []byte) error {
+	var t Tools
+
+	parsed, err := t.ParseULID(string(text))
+	if err != nil {
+		return err
+	}
+
+	*u = parsed
+	return nil
+}
+
+func readUint48(b []byte) uint64 {
+	return uint64(b[0])<<40 | uint64(b[1])<<32 | uint64(b[2])<<24 | uint64(b[3])<<16 | uint64(b[4])<<8 | uint64(b[5])
+}
+
+func putUint48(b []byte, v uint64) {
+	b[0] = byte(v >> 40)
+	b[1] = byte(v >> 32)
+	b[2] = byte(v >> 24)
+	b[3] = byte(v >> 16)
+	b[4] = byte(v >> 8)
+	b[5] = byte(v)
+}
+
+// ids made in the same millisecond must still sort in the order they were
+// made, so we remember the last one and count up from it
+var (
+	idMu     sync.Mutex
+	lastV7   UUID
+	lastULID ULID
+	// swapped in tests
+	idClock = time.Now
+)
+
+// NewUUIDv4 returns a random UUID
+func (t *Tools) NewUUIDv4() (UUID, error) {
+	var u UUID
+
+	if _, err := io.ReadFull(randomReader, u[:]); err != nil {
+		return UUID{}, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // variant 10
+
+	return u, nil
+}
+
+// NewUUIDv7 returns a time ordered UUID: the first 48 bits are the unix time
+// in milliseconds, so they sort by creation time, and the rest is random.
+// UUIDs made in the same millisecond count up from each other
+func (t *Tools) NewUUIDv7() (UUID, error) {
+	var u UUID
+
+	if _, err := io.ReadFull(randomReader, u[6:]); err != nil {
+		return UUID{}, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	idMu.Lock()
+	defer idMu.Unlock()
+
+	ms := uint64(idClock().UnixMilli())
+	last := readUint48(lastV7[0:6])
+
+	if ms <= last {
+		// same millisecond (or the clock went back): bump the 12 bits of rand_a,
+		// moving on to the next millisecond when they run out
+		ms = last
+		counter := (uint16(lastV7[6]&0x0f)<<8 | uint16(lastV7[7])) + 1
+		if counter > 0x0fff {
+			ms++
+			counter = 0
+		}
+		u[6] = byte(counter >> 8)
+		u[7] = byte(counter)
+	}
+
+	putUint48(u[0:6], ms)
+	u[6] = u[6]&0x0f | 0x70 // version 7
+	u[8] = u[8]&0x3f | 0x80 // variant 10
+
+	lastV7 = u
+
+	return u, nil
+}
+
+// NewULID returns a new ULID. ULIDs made in the same
+// millisecond count up from each other, as the spec suggests
+func (t *Tools) NewULID() (ULID, error) {
+	var u ULID
+
+	if _, err := io.ReadFull(randomReader, u[6:]); err != nil {
+		return ULID{}, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	idMu.Lock()
+	defer idMu.Unlock()
+
+	ms := uint64(idClock().UnixMilli())
+	last := readUint48(lastULID[0:6])
+
+	if ms <= last {
+		ms = last
+		u = lastULID
+
+		// adds one to the 80 random bits
+		i := len(u) - 1
+		for ; i >= 6; i-- {
+			u[i]++
+			if u[i] != 0 {
+				break
+			}
+		}
+
+		if i < 6 {
+			return ULID{}, errors.New("ulid random part overflow")
+		}
+	}
+
+	putUint48(u[0:6], ms)
+
+	lastULID = u
+
+	return u, nil
+}
+
+// ParseUUID parses the canonical UUID form, also accepting
+// uppercase, braces and the "urn:uuid:" prefix
+func (t *Tools) ParseUUID(s string) (UUID, error) {
+	original := s
+
+	s = strings.TrimPrefix(strings.ToLower(s), "urn:uuid:")
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return UUID{}, fmt.Errorf("invalid UUID %q", original)
+	}
+
+	var u UUID
+	hexString := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	if _, err := hex.Decode(u[:], []byte(hexString)); err != nil {
+		return UUID{}, fmt.Errorf("invalid UUID %q", original)
+	}
+
+	return u, nil
+}
+
+// IsValidUUID tells if s is a UUID
+func (t *Tools) IsValidUUID(s string) bool {
+	_, err := t.ParseUUID(s)
+	return err == nil
+}
+
+// ParseULID parses the 26 characters form of a ULID, case insensitive
+func (t *Tools) ParseULID(s string) (ULID, error) {
+	if len(s) != 26 || s[0] > '7' {
+		return ULID{}, fmt.Errorf("invalid ULID %q", s)
+	}
+
+	var u ULID
+	var carry uint
+	var bitCount uint
+	pos := len(u) - 1
+
+	upper := strings.ToUpper(s)
+	for i := len(upper) - 1; i >= 0; i-- {
+		v := strings.IndexByte(AlphabetCrockford, upper[i])
+		if v < 0 {
+			return ULID{}, fmt.Errorf("invalid ULID %q", s)
+		}
+
+		carry |= uint(v) << bitCount
+		bitCount += 5
+
+		if bitCount >= 8 && pos >= 0 {
+			u[pos] = byte(carry)
+			pos--
+			carry >>= 8
+			bitCount -= 8
+		}
+	}
+
+	return u, nil
+}
+
+// IsValidULID tells if s is a ULID
+func (t *Tools) IsValidULID(s string) bool {
+	_, err := t.ParseULID(s)
+	return err == nil
+}
+
+// FileNameFormat is how UploadFiles names renamed files
+type FileNameFormat int
+
+const (
+	// FileNameRandom is a random string of 10 letters and digits, the default
+	FileNameRandom FileNameFormat = iota
+	// FileNameUUIDv4 is a random UUID
+	FileNameUUIDv4
+	// FileNameUUIDv7 is a time ordered UUID, files sort by upload time
+	FileNameUUIDv7
+	// FileNameULID is a ULID, files sort by upload time
+	FileNameULID
+)
+
+// the name, without extension, for a renamed upload
+func (t *Tools) newFileName() (string, error) {
+	switch t.UploadFileNameFormat {
+	case FileNameUUIDv4:
+		u, err := t.NewUUIDv4()
+		return u.String(), err
+	case FileNameUUIDv7:
+		u, err := t.NewUUIDv7()
+		return u.String(), err
+	case FileNameULID:
+		u, err := t.NewULID()
+		return u.String(), err
+	default:
+		// not RandomAlphabet, the name ends up in a path
+		return randomString(10, AlphabetAlphanumeric)
+	}
+}
@@ -0,0 +1,224 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_NewUUIDv4(t *testing.T) {
+	var testTools Tools
+
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	seen := make(map[UUID]bool)
+	for i := 0; i < 100; i++ {
+		u, err := testTools.NewUUIDv4()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !re.MatchString(u.String()) {
+			t.Errorf("wrong uuid v4: %s", u)
+		}
+
+		if seen[u] {
+			t.Fatalf("duplicated uuid: %s", u)
+		}
+		seen[u] = true
+	}
+}
+
+func TestTools_NewUUIDv7(t *testing.T) {
+	var testTools Tools
+
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	before := time.Now().Truncate(time.Millisecond)
+
+	var ids []string
+	for i := 0; i < 1000; i++ {
+		u, err := testTools.NewUUIDv7()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !re.MatchString(u.String()) {
+			t.Fatalf("wrong uuid v7: %s", u)
+		}
+
+		if u.Version() != 7 || u.Time().Before(before) {
+			t.Fatalf("wrong version or time: %d %s", u.Version(), u.Time())
+		}
+
+		ids = append(ids, u.String())
+	}
+
+	// many of them are made in the same millisecond, they must still sort
+	if !sort.StringsAreSorted(ids) {
+		t.Error("uuid v7 should sort by creation")
+	}
+}
+
+func TestTools_NewULID(t *testing.T) {
+	var testTools Tools
+
+	re := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+
+	before := time.Now().Truncate(time.Millisecond)
+
+	var ids []string
+	for i := 0; i < 1000; i++ {
+		u, err := testTools.NewULID()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !re.MatchString(u.String()) {
+			t.Fatalf("wrong ulid: %s", u)
+		}
+
+		if u.Time().Before(before) {
+			t.Fatalf("wrong time: %s", u.Time())
+		}
+
+		ids = append(ids, u.String())
+	}
+
+	if !sort.StringsAreSorted(ids) {
+		t.Error("ulids should sort by creation")
+	}
+}
+
+func TestTools_IDsClockBackwards(t *testing.T) {
+	var testTools Tools
+
+	first, _ := testTools.NewULID()
+	firstV7, _ := testTools.NewUUIDv7()
+
+	idClock = func() time.Time { return time.Now().Add(-time.Hour) }
+	defer func() { idClock = time.Now }()
+
+	second, _ := testTools.NewULID()
+	secondV7, _ := testTools.NewUUIDv7()
+
+	if second.String() <= first.String() || secondV7.String() <= firstV7.String() {
+		t.Error("ids should keep growing when the clock goes back")
+	}
+}
+
+var parseUUIDTests = []struct {
+	testName string
+	input    string
+	expected string
+	valid    bool
+}{
+	{testName: "canonical", input: "0189c8a2-7d3e-7b1a-9f3c-2a4b6c8d0e1f", expected: "0189c8a2-7d3e-7b1a-9f3c-2a4b6c8d0e1f", valid: true},
+	{testName: "uppercase", input: "0189C8A2-7D3E-7B1A-9F3C-2A4B6C8D0E1F", expected: "0189c8a2-7d3e-7b1a-9f3c-2a4b6c8d0e1f", valid: true},
+	{testName: "braces", input: "{0189c8a2-7d3e-7b1a-9f3c-2a4b6c8d0e1f}", expected: "0189c8a2-7d3e-7b1a-9f3c-2a4b6c8d0e1f", valid: true},
+	{testName: "urn", input: "urn:uuid:0189c8a2-7d3e-7b1a-9f3c-2a4b6c8d0e1f", expected: "0189c8a2-7d3e-7b1a-9f3c-2a4b6c8d0e1f", valid: true},
+	{testName: "no dashes", input: "0189c8a27d3e7b1a9f3c2a4b6c8d0e1f", valid: false},
+	{testName: "not hex", input: "0189c8a2-7d3e-7b1a-9f3c-2a4b6c8d0e1g", valid: false},
+	{testName: "too short", input: "0189c8a2-7d3e-7b1a-9f3c", valid: false},
+	{testName: "empty", input: "", valid: false},
+}
+
+func TestTools_ParseUUID(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range parseUUIDTests {
+		u, err := testTools.ParseUUID(e.input)
+
+		if e.valid && err != nil {
+			t.Errorf("%s: %v", e.testName, err)
+			continue
+		}
+
+		if !e.valid && err == nil {
+			t.Errorf("%s: error expected but not received", e.testName)
+			continue
+		}
+
+		if e.valid && u.String() != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.testName, e.expected, u)
+		}
+
+		if testTools.IsValidUUID(e.input) != e.valid {
+			t.Errorf("%s: IsValidUUID should be %v", e.testName, e.valid)
+		}
+	}
+}
+
+var parseULIDTests = []struct {
+	testName string
+	input    string
+	valid    bool
+}{
+	{testName: "valid", input: "01ARZ3NDEKTSV4RRFFQ69G5FAV", valid: true},
+	{testName: "lowercase", input: "01arz3ndektsv4rrffq69g5fav", valid: true},
+	{testName: "largest", input: "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", valid: true},
+	{testName: "overflow", input: "8ZZZZZZZZZZZZZZZZZZZZZZZZZ", valid: false},
+	{testName: "invalid character", input: "01ARZ3NDEKTSV4RRFFQ69G5FAU", valid: false},
+	{testName: "too short", input: "01ARZ3NDEKTSV4RRFFQ69G5FA", valid: false},
+}
+
+func TestTools_ParseULID(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range parseULIDTests {
+		u, err := testTools.ParseULID(e.input)
+
+		if e.valid && err != nil {
+			t.Errorf("%s: %v", e.testName, err)
+			continue
+		}
+
+		if !e.valid && err == nil {
+			t.Errorf("%s: error expected but not received", e.testName)
+			continue
+		}
+
+		if e.valid && u.String() != strings.ToUpper(e.input) {
+			t.Errorf("%s: round trip failed, got %s", e.testName, u)
+		}
+	}
+
+	// the example from the spec
+	u, _ := testTools.ParseULID("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	if u.Time().UnixMilli() != 1469922850259 {
+		t.Errorf("wrong ulid time: %d", u.Time().UnixMilli())
+	}
+}
+
+func TestTools_IDsJSON(t *testing.T) {
+	var testTools Tools
+
+	id, _ := testTools.NewUUIDv7()
+	ulid, _ := testTools.NewULID()
+
+	payload := struct {
+		ID   UUID `json:"id"`
+		ULID ULID `json:"ulid"`
+	}{ID: id, ULID: ulid}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload.ID, payload.ULID = UUID{}, ULID{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.ID != id || payload.ULID != ulid {
+		t.Errorf("ids changed going through json: %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"id":"nope"}`), &payload); err == nil {
+		t.Error("invalid uuid should fail to unmarshal")
+	}
+}
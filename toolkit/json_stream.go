@@ -0,0 +1,177 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ReadJSONStream reads a body holding many JSON values, either as a top level
+// array or as NDJSON (one value per line), and calls fn once per item.
+// fn receives the item index and a decode function that fills v
+// using the same rules and friendly errors as ReadJSON.
+// Returning an error from fn stops the reading.
+// Each item is limited while it's read, so a huge one is
+// rejected without being held in memory.
+func (t *Tools) ReadJSONStream(w http.ResponseWriter, r *http.Request, fn func(index int, decode func(v interface{}) error) error) error {
+	maxItemBytes := 1024 * 1024 // 1mb
+	if t.MaxJSONItemSize != 0 {
+		maxItemBytes = t.MaxJSONItemSize
+	} else if t.MaxJSONSize != 0 {
+		maxItemBytes = t.MaxJSONSize
+	}
+
+	maxBytes := 10 * 1024 * 1024 // 10mb
+	if t.MaxJSONStreamSize != 0 {
+		maxBytes = t.MaxJSONStreamSize
+	}
+
+	// same idea as in ReadJSON, but now for the whole batch
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	if err := t.decompressBody(w, r, maxBytes); err != nil {
+		return err
+	}
+
+	if err := t.checkJSONContentType(r, "application/x-ndjson", "application/jsonl"); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r.Body)
+
+	// peeking the first meaningful byte tells us
+	// if we got an array or a bunch of lines
+	isArray, err := startsWithArray(br)
+	if err != nil {
+		return jsonDecodeError(err, maxBytes)
+	}
+
+	items := &itemLimitReader{r: br, limit: -1}
+	dec := json.NewDecoder(items)
+
+	if isArray {
+		// consumes the opening '['
+		if _, err := dec.Token(); err != nil {
+			return jsonDecodeError(err, maxBytes)
+		}
+	}
+
+	index := 0
+	for {
+		if isArray && !dec.More() {
+			break
+		}
+
+		// the decoder can't read past the end of this item, with some
+		// room for what separates it from the next one
+		items.limit = dec.InputOffset() + int64(maxItemBytes) + itemSlack
+
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if !isArray && errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, errItemTooLarge) {
+			return fmt.Errorf("item %d: item must not be larger than %d bytes", index, maxItemBytes)
+		}
+		if err != nil {
+			return fmt.Errorf("item %d: %w", index, jsonDecodeError(err, maxBytes))
+		}
+
+		if len(raw) > maxItemBytes {
+			return fmt.Errorf("item %d: item must not be larger than %d bytes", index, maxItemBytes)
+		}
+
+		itemIndex := index
+		decode := func(v interface{}) error {
+			itemDec := json.NewDecoder(bytes.NewReader(raw))
+
+			if !t.AllowJSONUnknownFields {
+				itemDec.DisallowUnknownFields()
+			}
+
+			if err := itemDec.Decode(v); err != nil {
+				return fmt.Errorf("item %d: %w", itemIndex, jsonDecodeError(err, maxItemBytes))
+			}
+
+			return nil
+		}
+
+		if err := fn(index, decode); err != nil {
+			return err
+		}
+
+		index++
+	}
+
+	items.limit = -1
+
+	if isArray {
+		// consumes the closing ']'
+		if _, err := dec.Token(); err != nil {
+			return jsonDecodeError(err, maxBytes)
+		}
+
+		err = dec.Decode(&struct{}{})
+		if err != io.EOF {
+			return errors.New("body must contain only one json array")
+		}
+	}
+
+	return nil
+}
+
+// bytes an item can be followed by, like white space
+// and commas, before it counts as too large
+const itemSlack = 512
+
+var errItemTooLarge = errors.New("item too large")
+
+// stops the decoder from reading more than limit bytes
+// in total, a negative limit means there's none
+type itemLimitReader struct {
+	r     io.Reader
+	read  int64
+	limit int64
+}
+
+func (l *itemLimitReader) Read(p []byte) (int, error) {
+	if l.limit >= 0 {
+		left := l.limit - l.read
+		if left <= 0 {
+			return 0, errItemTooLarge
+		}
+		if int64(len(p)) > left {
+			p = p[:left]
+		}
+	}
+
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+
+	return n, err
+}
+
+// skips the leading white space and tells if the
+// next character is the beginning of an array
+func startsWithArray(br *bufio.Reader) (bool, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return false, err
+		}
+
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = br.ReadByte()
+		case '[':
+			return true, nil
+		default:
+			return false, nil
+		}
+	}
+}
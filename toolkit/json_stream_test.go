@@ -0,0 +1,126 @@
+package toolkit
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var jsonStreamTests = []struct {
+	testName      string
+	json          string
+	errorExpected bool
+	errorContains string
+	itemsExpected int
+	maxItemSize   int
+	maxStreamSize int
+	allowUnknown  bool
+}{
+	{testName: "json array", json: `[{"foo": "bar"}, {"foo": "baz"}]`, itemsExpected: 2},
+	{testName: "empty array", json: ` [] `, itemsExpected: 0},
+	{testName: "ndjson", json: "{\"foo\": \"bar\"}\n{\"foo\": \"baz\"}\n{\"foo\": \"qux\"}\n", itemsExpected: 3},
+	{testName: "empty body", json: "", errorExpected: true, errorContains: "body must not be empty"},
+	{testName: "bad item in array", json: `[{"foo": "bar"}, {"foo": 1}]`, errorExpected: true, errorContains: "item 1: body contains incorrect JSON type"},
+	{testName: "unknown field in ndjson", json: "{\"foo\": \"bar\"}\n{\"bar\": \"foo\"}", errorExpected: true, errorContains: "item 1: body contains unknown key"},
+	{testName: "allow unknown fields", json: "{\"foo\": \"bar\"}\n{\"bar\": \"foo\"}", itemsExpected: 2, allowUnknown: true},
+	{testName: "badly formed item", json: "{\"foo\": \"bar\"}\n{\"foo\":}", errorExpected: true, errorContains: "item 1: body contains badly-formed JSON"},
+	{testName: "item too large", json: `[{"foo": "bar"}, {"foo": "a very long value"}]`, maxItemSize: 20, errorExpected: true, errorContains: "item 1: item must not be larger than 20 bytes"},
+	{testName: "stream too large", json: `[{"foo": "bar"}, {"foo": "baz"}]`, maxStreamSize: 20, errorExpected: true, errorContains: "body must not be larger than 20 bytes"},
+	{testName: "two arrays", json: `[{"foo": "bar"}][{"foo": "bar"}]`, errorExpected: true, errorContains: "only one json array"},
+	{testName: "unclosed array", json: `[{"foo": "bar"}`, errorExpected: true},
+}
+
+func TestTools_ReadJSONStream(t *testing.T) {
+	for _, e := range jsonStreamTests {
+		testTool := Tools{
+			MaxJSONItemSize:        e.maxItemSize,
+			MaxJSONStreamSize:      e.maxStreamSize,
+			AllowJSONUnknownFields: e.allowUnknown,
+		}
+
+		req, err := http.NewRequest("POST", "/", bytes.NewReader([]byte(e.json)))
+		if err != nil {
+			t.Error(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		var items []string
+		err = testTool.ReadJSONStream(rr, req, func(index int, decode func(v interface{}) error) error {
+			var item struct {
+				Foo string `json:"foo"`
+			}
+
+			if err := decode(&item); err != nil {
+				return err
+			}
+
+			items = append(items, item.Foo)
+			return nil
+		})
+
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected but none received", e.testName)
+			} else if !strings.Contains(err.Error(), e.errorContains) {
+				t.Errorf("%s: expected error containing %q but got %q", e.testName, e.errorContains, err.Error())
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.testName, err.Error())
+		}
+
+		if len(items) != e.itemsExpected {
+			t.Errorf("%s: expected %d items but got %d", e.testName, e.itemsExpected, len(items))
+		}
+	}
+}
+
+// counts the bytes read from it
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestTools_ReadJSONStreamItemLimit(t *testing.T) {
+	testTool := Tools{MaxJSONItemSize: 1024}
+
+	// a small item and then a huge one
+	body := &countingReader{r: io.MultiReader(
+		strings.NewReader(`[{"foo": "bar"}, {"foo": "`),
+		strings.NewReader(strings.Repeat("a", 5*1024*1024)),
+		strings.NewReader(`"}]`),
+	)}
+
+	req := httptest.NewRequest("POST", "/", body)
+
+	items := 0
+	err := testTool.ReadJSONStream(httptest.NewRecorder(), req, func(index int, decode func(v interface{}) error) error {
+		items++
+		return nil
+	})
+
+	if err == nil || err.Error() != "item 1: item must not be larger than 1024 bytes" {
+		t.Errorf("expected the item to be too large, got %v", err)
+	}
+
+	if items != 1 {
+		t.Errorf("expected the first item to be read, got %d", items)
+	}
+
+	// stopped around the limit instead of reading the whole item
+	if body.read > 64*1024 {
+		t.Errorf("expected the reading to stop early, read %d bytes", body.read)
+	}
+}
@@ -0,0 +1,313 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is a FileSystem kept in memory, for tests. It has no symlinks, and
+// the only permission it checks is the write bit of the directory a file is
+// written to. The zero value is not usable, use NewMemFS
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemFS creates an empty MemFS, with only the "." and "/" directories
+func NewMemFS() *MemFS {
+	now := time.Now()
+
+	return &MemFS{
+		files: map[string]*memFile{
+			".": {mode: fs.ModeDir | 0755, modTime: now},
+			"/": {mode: fs.ModeDir | 0755, modTime: now},
+		},
+	}
+}
+
+func memPath(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+// must be called with the lock held
+func (m *MemFS) parentDir(op, name string) error {
+	parent, ok := m.files[path.Dir(name)]
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+	}
+
+	if parent.mode.Perm()&0200 == 0 {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+
+	return nil
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memPath(name)
+
+	f, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &memHandle{info: f.info(name), reader: bytes.NewReader(f.data)}, nil
+}
+
+// Create creates or truncates name, what is written shows up when it's closed
+func (m *MemFS) Create(name string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memPath(name)
+
+	if err := m.parentDir("open", name); err != nil {
+		return nil, err
+	}
+
+	if f, ok := m.files[name]; ok && f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+
+	m.files[name] = &memFile{mode: 0644, modTime: time.Now()}
+
+	return &memWriter{fs: m, name: name}, nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memPath(name)
+
+	f, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return f.info(name), nil
+}
+
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	return m.Stat(name)
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memPath(name)
+
+	dir, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if !dir.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: errors.New("not a directory")}
+	}
+
+	var entries []fs.DirEntry
+	for p, f := range m.files {
+		if p != name && path.Dir(p) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(f.info(p)))
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memPath(name)
+
+	// parents first
+	var missing []string
+	for p := name; ; p = path.Dir(p) {
+		if f, ok := m.files[p]; ok {
+			if !f.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: errors.New("not a directory")}
+			}
+			break
+		}
+		missing = append(missing, p)
+
+		if path.Dir(p) == p {
+			break
+		}
+	}
+
+	now := time.Now()
+	for i := len(missing) - 1; i >= 0; i-- {
+		m.files[missing[i]] = &memFile{mode: fs.ModeDir | perm.Perm(), modTime: now}
+	}
+
+	return nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memPath(name)
+
+	if err := m.parentDir("open", name); err != nil {
+		return err
+	}
+
+	if f, ok := m.files[name]; ok && f.mode.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+
+	m.files[name] = &memFile{data: append([]byte(nil), data...), mode: perm.Perm(), modTime: time.Now()}
+
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memPath(name)
+
+	f, ok := m.files[name]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if f.mode.IsDir() {
+		prefix := strings.TrimSuffix(name, "/") + "/"
+		for p := range m.files {
+			if p != name && strings.HasPrefix(p, prefix) {
+				return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+			}
+		}
+	}
+
+	delete(m.files, name)
+
+	return nil
+}
+
+// Chmod changes the permission bits of name, to test unwritable directories
+func (m *MemFS) Chmod(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[memPath(name)]
+	if !ok {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrNotExist}
+	}
+
+	f.mode = f.mode.Type() | perm.Perm()
+
+	return nil
+}
+
+// Chtimes changes the modification time of name, to test anything based on age
+func (m *MemFS) Chtimes(name string, modTime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[memPath(name)]
+	if !ok {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrNotExist}
+	}
+
+	f.modTime = modTime
+
+	return nil
+}
+
+func (f *memFile) info(name string) fs.FileInfo {
+	return &memFileInfo{name: path.Base(name), size: int64(len(f.data)), mode: f.mode, modTime: f.modTime}
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memFileInfo) Sys() interface{}   { return nil }
+
+// an open MemFS file, reading a snapshot of its data
+type memHandle struct {
+	info   fs.FileInfo
+	reader *bytes.Reader
+}
+
+func (h *memHandle) Stat() (fs.FileInfo, error) { return h.info, nil }
+func (h *memHandle) Read(p []byte) (int, error) {
+	if h.info.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: h.info.Name(), Err: errors.New("is a directory")}
+	}
+	return h.reader.Read(p)
+}
+func (h *memHandle) Close() error { return nil }
+
+// a MemFS file being written
+type memWriter struct {
+	fs     *MemFS
+	name   string
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memWriter) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	f, ok := w.fs.files[w.name]
+	if !ok {
+		// removed while being written
+		return nil
+	}
+
+	f.data = w.buf.Bytes()
+	f.modTime = time.Now()
+
+	return nil
+}
@@ -0,0 +1,489 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Middleware wraps a handler. Tools methods like Recoverer and
+// RequestID are middlewares too, so they can be mixed in Chain
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h with the middlewares, the first one being the outermost,
+// so Chain(mux, t.RequestID, t.Recoverer, t.AccessLog) recovers panics
+// from everything after it, with the request id already known
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
+
+// RequestIDHeader is where RequestID reads and writes request ids
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	clientIPKey
+)
+
+// MethodNotAllowedError is returned for requests AllowMethods refuses
+type MethodNotAllowedError struct {
+	Method  string
+	Allowed []string
+}
+
+func (e *MethodNotAllowedError) Error() string {
+	return fmt.Sprintf("method %s not allowed", e.Method)
+}
+
+// keeps what the handler wrote, for Recoverer and AccessLog
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the real writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		if r.status == 0 {
+			r.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := r.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, http.ErrNotSupported
+}
+
+// wraps w only once, however many middlewares want to know the status
+func recordStatus(w http.ResponseWriter) *statusRecorder {
+	if rec, ok := w.(*statusRecorder); ok {
+		return rec
+	}
+
+	return &statusRecorder{ResponseWriter: w}
+}
+
+func (t *Tools) logger() *slog.Logger {
+	if t.Logger != nil {
+		return t.Logger
+	}
+
+	return slog.Default()
+}
+
+// Recoverer turns a panic in next into a 500 through ErrorJSONResponse,
+// logging it with its stack trace. Nothing is written if the handler
+// had already started its response, there's no fixing that
+func (t *Tools) Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recordStatus(w)
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+
+			// the way handlers abort on purpose, net/http deals with it
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			t.logger().ErrorContext(r.Context(), "panic serving request",
+				slog.Any("panic", v),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("request_id", RequestIDFromContext(r.Context())),
+				slog.String("stack", string(debug.Stack())),
+			)
+
+			if rec.status == 0 {
+				_ = t.ErrorJSONResponse(rec, errors.New(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// RequestID gives every request an id, the one in the X-Request-ID header
+// when the client or a proxy sent a sane one, or a new UUIDv7. It's echoed in
+// the response, available through RequestIDFromContext, logged by AccessLog
+// and sent along by the outbound calls made with the request context
+func (t *Tools) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+
+		if !validRequestID(id) {
+			u, err := t.NewUUIDv7()
+			if err != nil {
+				_ = t.ErrorJSONResponse(w, err, http.StatusInternalServerError)
+				return
+			}
+			id = u.String()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// ids from outside end up in our logs and headers, so they must be short and printable
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RequestIDFromContext returns the id RequestID gave the request, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// AccessLog logs every request once it's served through Logger (slog.Default()
+// when nil): method, path, status, bytes written, duration, client ip, user
+// agent and request id. Server errors are logged as errors, the rest as info.
+// A panic is logged as a 500 and passed on, for Recoverer to deal with
+func (t *Tools) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := recordStatus(w)
+
+		defer func() {
+			status := rec.status
+			if status == 0 {
+				// nothing written is an empty 200
+				status = http.StatusOK
+			}
+
+			// a Recoverer further out answers with a 500, log that and let it
+			v := recover()
+			if v != nil && rec.status == 0 {
+				status = http.StatusInternalServerError
+			}
+
+			level := slog.LevelInfo
+			if status >= 500 {
+				level = slog.LevelError
+			}
+
+			t.logger().LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int64("bytes", rec.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("ip", ClientIP(r)),
+				slog.String("user_agent", r.UserAgent()),
+				slog.String("request_id", RequestIDFromContext(r.Context())),
+			)
+
+			if v != nil {
+				panic(v)
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// AllowMethods refuses requests with other methods with a 405 through
+// ErrorJSONResponse, and an Allow header listing the allowed ones.
+// HEAD is allowed along with GET, and OPTIONS, unless allowed too, is
+// answered right away with the Allow header
+func (t *Tools) AllowMethods(methods ...string) Middleware {
+	allowed := make(map[string]bool)
+	var list []string
+
+	add := func(method string) {
+		method = strings.ToUpper(method)
+		if !allowed[method] {
+			allowed[method] = true
+			list = append(list, method)
+		}
+	}
+
+	for _, method := range methods {
+		add(method)
+		if strings.EqualFold(method, http.MethodGet) {
+			add(http.MethodHead)
+		}
+	}
+
+	allowHeader := strings.Join(append(list, http.MethodOptions), ", ")
+	if allowed[http.MethodOptions] {
+		allowHeader = strings.Join(list, ", ")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if allowed[r.Method] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Allow", allowHeader)
+
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			_ = t.ErrorJSONResponse(w, &MethodNotAllowedError{Method: r.Method, Allowed: list})
+		})
+	}
+}
+
+// CORSOptions configure the CORS middleware
+type CORSOptions struct {
+	// origins allowed to call us, like "https://example.com", "*" for anyone
+	// or "https://*.example.com" for any subdomain
+	AllowedOrigins []string
+	// methods allowed in preflights (default GET, HEAD and POST)
+	AllowedMethods []string
+	// headers allowed in preflights, the ones asked for are allowed when empty
+	AllowedHeaders []string
+	// response headers the browser lets scripts read
+	ExposedHeaders []string
+	// lets cookies and auth headers through, "*" origins are echoed back then
+	AllowCredentials bool
+	// how long browsers may cache a preflight
+	MaxAge time.Duration
+}
+
+// CORS answers preflight requests and adds the CORS headers to the others,
+// for allowed origins. Requests from other origins go through without
+// them, so browsers keep the response from the calling page
+func (t *Tools) CORS(options CORSOptions) Middleware {
+	methods := options.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+
+	allowedMethods := strings.ToUpper(strings.Join(methods, ", "))
+	allowedHeaders := strings.Join(options.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(options.ExposedHeaders, ", ")
+
+	anyOrigin := false
+	for _, o := range options.AllowedOrigins {
+		if o == "*" {
+			anyOrigin = true
+		}
+	}
+
+	originAllowed := func(origin string) bool {
+		if anyOrigin {
+			return true
+		}
+
+		for _, o := range options.AllowedOrigins {
+			if strings.EqualFold(o, origin) {
+				return true
+			}
+
+			// "https://*.example.com" takes "https://api.example.com"
+			if before, after, ok := strings.Cut(o, "*"); ok &&
+				len(origin) > len(before)+len(after) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(before)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(after)) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			// the answer depends on the origin, caches must know that
+			w.Header().Add("Vary", "Origin")
+
+			if origin == "" || !originAllowed(origin) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			if anyOrigin && !options.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if options.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposedHeaders != "" {
+					h.Set("Access-Control-Expose-Headers", exposedHeaders)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", allowedMethods)
+
+			if allowedHeaders != "" {
+				h.Set("Access-Control-Allow-Headers", allowedHeaders)
+			} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+
+			if options.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(options.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// RealIP finds the client ip of requests coming through TrustedProxies, from
+// the X-Forwarded-For or X-Real-IP headers, for ClientIP. Those headers are
+// ignored when the request doesn't come from a trusted proxy, since
+// anybody can send them. It panics when wrapping if a TrustedProxies
+// entry is neither an ip nor a cidr
+func (t *Tools) RealIP(next http.Handler) http.Handler {
+	var trusted []netip.Prefix
+	for _, p := range t.TrustedProxies {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(p)
+			if addrErr != nil {
+				panic(fmt.Sprintf("toolkit: invalid trusted proxy %q", p))
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		trusted = append(trusted, prefix)
+	}
+
+	isTrusted := func(addr netip.Addr) bool {
+		addr = addr.Unmap()
+		for _, p := range trusted {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := remoteIP(r)
+
+		if addr, err := netip.ParseAddr(ip); err == nil && isTrusted(addr) {
+			if client := forwardedClient(r, isTrusted); client != "" {
+				ip = client
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey, ip)))
+	})
+}
+
+// the first address that isn't a trusted proxy, going back from
+// the one closest to us, since only those could be forged
+func forwardedClient(r *http.Request, isTrusted func(netip.Addr) bool) string {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return ""
+		}
+
+		if !isTrusted(addr) || i == 0 {
+			return addr.Unmap().String()
+		}
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+
+	return ""
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// ClientIP returns the ip RealIP found for the request,
+// or the address the request came from without it
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+
+	return remoteIP(r)
+}
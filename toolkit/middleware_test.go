@@ -0,0 +1,354 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), mark("first"), mark("second"))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if strings.Join(order, ",") != "first,second,handler" {
+		t.Errorf("wrong order: %v", order)
+	}
+}
+
+func TestTools_Recoverer(t *testing.T) {
+	var logs bytes.Buffer
+	testTools := Tools{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), testTools.RequestID, testTools.Recoverer)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "panic-id")
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 but got %d", rr.Code)
+	}
+
+	var payload JSONResponse
+	if err := json.NewDecoder(rr.Body).Decode(&payload); err != nil || !payload.Error {
+		t.Errorf("expected a json error, got %v (%v)", payload, err)
+	}
+
+	if !strings.Contains(logs.String(), `"panic":"boom"`) || !strings.Contains(logs.String(), `"request_id":"panic-id"`) {
+		t.Errorf("panic not logged: %s", logs.String())
+	}
+
+	// too late to answer once the response started
+	h = testTools.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("boom")
+	}))
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusAccepted || rr.Body.Len() != 0 {
+		t.Errorf("nothing should be written after the response started, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestTools_RequestID(t *testing.T) {
+	var testTools Tools
+
+	var seen string
+	h := testTools.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	// a new one
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !testTools.IsValidUUID(seen) || rr.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("expected a new uuid, got %q and %q", seen, rr.Header().Get(RequestIDHeader))
+	}
+
+	// kept from the client
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if seen != "abc-123" {
+		t.Errorf("expected the incoming id, got %q", seen)
+	}
+
+	// but not when it's junk
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\twith spaces")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if seen == "bad id\twith spaces" {
+		t.Error("an invalid incoming id should be replaced")
+	}
+}
+
+func TestTools_RequestIDPropagation(t *testing.T) {
+	var received string
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(RequestIDHeader)
+	}))
+	defer remote.Close()
+
+	var testTools Tools
+
+	h := testTools.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := testTools.PushJSONToRemoteContext(r.Context(), remote.URL, map[string]string{"foo": "bar"})
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "trace-me")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if received != "trace-me" {
+		t.Errorf("the request id should be sent along, got %q", received)
+	}
+}
+
+func TestTools_AccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	testTools := Tools{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSON(w, http.StatusCreated, map[string]string{"foo": "bar"})
+	}), testTools.RequestID, testTools.AccessLog)
+
+	req := httptest.NewRequest(http.MethodPost, "/things", nil)
+	req.Header.Set(RequestIDHeader, "log-me")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{"level": "INFO", "method": "POST", "path": "/things", "status": 201.0, "bytes": 13.0, "request_id": "log-me", "ip": "192.0.2.1"}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("expected %s to be %v but got %v", k, v, entry[k])
+		}
+	}
+}
+
+func TestTools_AccessLogPanic(t *testing.T) {
+	var logs bytes.Buffer
+	testTools := Tools{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+
+	// the order Chain recommends
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), testTools.RequestID, testTools.Recoverer, testTools.AccessLog)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 but got %d", rr.Code)
+	}
+
+	var access map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err == nil && entry["msg"] == "request" {
+			access = entry
+		}
+	}
+
+	if access == nil || access["status"] != 500.0 || access["level"] != "ERROR" {
+		t.Errorf("expected the access log to say 500, got %v", access)
+	}
+}
+
+var allowMethodsTests = []struct {
+	testName string
+	method   string
+	status   int
+	allow    string
+}{
+	{testName: "allowed", method: http.MethodPost, status: http.StatusOK},
+	{testName: "head with get", method: http.MethodHead, status: http.StatusOK},
+	{testName: "not allowed", method: http.MethodDelete, status: http.StatusMethodNotAllowed, allow: "GET, HEAD, POST, OPTIONS"},
+	{testName: "options", method: http.MethodOptions, status: http.StatusNoContent, allow: "GET, HEAD, POST, OPTIONS"},
+}
+
+func TestTools_AllowMethods(t *testing.T) {
+	var testTools Tools
+
+	h := testTools.AllowMethods(http.MethodGet, http.MethodPost)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, e := range allowMethodsTests {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(e.method, "/", nil))
+
+		if rr.Code != e.status || rr.Header().Get("Allow") != e.allow {
+			t.Errorf("%s: expected %d (%s) but got %d (%s)", e.testName, e.status, e.allow, rr.Code, rr.Header().Get("Allow"))
+		}
+	}
+}
+
+var corsTests = []struct {
+	testName    string
+	options     CORSOptions
+	method      string
+	headers     map[string]string
+	status      int
+	expected    map[string]string
+	handlerRuns bool
+}{
+	{
+		testName:    "no origin",
+		options:     CORSOptions{AllowedOrigins: []string{"https://example.com"}},
+		method:      http.MethodGet,
+		status:      http.StatusOK,
+		expected:    map[string]string{"Access-Control-Allow-Origin": ""},
+		handlerRuns: true,
+	},
+	{
+		testName:    "allowed origin",
+		options:     CORSOptions{AllowedOrigins: []string{"https://example.com"}, ExposedHeaders: []string{"X-Request-ID"}},
+		method:      http.MethodGet,
+		headers:     map[string]string{"Origin": "https://example.com"},
+		status:      http.StatusOK,
+		expected:    map[string]string{"Access-Control-Allow-Origin": "https://example.com", "Access-Control-Expose-Headers": "X-Request-ID", "Vary": "Origin"},
+		handlerRuns: true,
+	},
+	{
+		testName:    "other origin",
+		options:     CORSOptions{AllowedOrigins: []string{"https://example.com"}},
+		method:      http.MethodGet,
+		headers:     map[string]string{"Origin": "https://evil.com"},
+		status:      http.StatusOK,
+		expected:    map[string]string{"Access-Control-Allow-Origin": ""},
+		handlerRuns: true,
+	},
+	{
+		testName:    "any origin",
+		options:     CORSOptions{AllowedOrigins: []string{"*"}},
+		method:      http.MethodGet,
+		headers:     map[string]string{"Origin": "https://anywhere.com"},
+		status:      http.StatusOK,
+		expected:    map[string]string{"Access-Control-Allow-Origin": "*"},
+		handlerRuns: true,
+	},
+	{
+		testName:    "subdomain with credentials",
+		options:     CORSOptions{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true},
+		method:      http.MethodGet,
+		headers:     map[string]string{"Origin": "https://api.example.com"},
+		status:      http.StatusOK,
+		expected:    map[string]string{"Access-Control-Allow-Origin": "https://api.example.com", "Access-Control-Allow-Credentials": "true"},
+		handlerRuns: true,
+	},
+	{
+		testName: "preflight",
+		options:  CORSOptions{AllowedOrigins: []string{"https://example.com"}, AllowedMethods: []string{"GET", "PUT"}, MaxAge: 600e9},
+		method:   http.MethodOptions,
+		headers:  map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "PUT", "Access-Control-Request-Headers": "Content-Type"},
+		status:   http.StatusNoContent,
+		expected: map[string]string{"Access-Control-Allow-Origin": "https://example.com", "Access-Control-Allow-Methods": "GET, PUT", "Access-Control-Allow-Headers": "Content-Type", "Access-Control-Max-Age": "600"},
+	},
+	{
+		testName: "preflight from other origin",
+		options:  CORSOptions{AllowedOrigins: []string{"https://example.com"}},
+		method:   http.MethodOptions,
+		headers:  map[string]string{"Origin": "https://evil.com", "Access-Control-Request-Method": "PUT"},
+		status:   http.StatusNoContent,
+		expected: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+	},
+}
+
+func TestTools_CORS(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range corsTests {
+		ran := false
+		h := testTools.CORS(e.options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ran = true
+		}))
+
+		req := httptest.NewRequest(e.method, "/", nil)
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.status || ran != e.handlerRuns {
+			t.Errorf("%s: expected %d (handler runs: %v) but got %d (%v)", e.testName, e.status, e.handlerRuns, rr.Code, ran)
+		}
+
+		for k, v := range e.expected {
+			if rr.Header().Get(k) != v {
+				t.Errorf("%s: expected %s to be %q but got %q", e.testName, k, v, rr.Header().Get(k))
+			}
+		}
+	}
+}
+
+var realIPTests = []struct {
+	testName   string
+	remoteAddr string
+	headers    map[string]string
+	expected   string
+}{
+	{testName: "direct", remoteAddr: "203.0.113.7:1234", expected: "203.0.113.7"},
+	{testName: "forged header from outside", remoteAddr: "203.0.113.7:1234", headers: map[string]string{"X-Forwarded-For": "1.2.3.4"}, expected: "203.0.113.7"},
+	{testName: "through proxy", remoteAddr: "10.0.0.5:1234", headers: map[string]string{"X-Forwarded-For": "198.51.100.9"}, expected: "198.51.100.9"},
+	{testName: "spoofed hop before proxies", remoteAddr: "10.0.0.5:1234", headers: map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.9, 10.0.0.2"}, expected: "198.51.100.9"},
+	{testName: "real ip header", remoteAddr: "10.0.0.5:1234", headers: map[string]string{"X-Real-IP": "198.51.100.9"}, expected: "198.51.100.9"},
+	{testName: "garbage", remoteAddr: "10.0.0.5:1234", headers: map[string]string{"X-Forwarded-For": "nope"}, expected: "10.0.0.5"},
+	{testName: "ipv6 proxy", remoteAddr: "[::1]:1234", headers: map[string]string{"X-Forwarded-For": "2001:db8::1"}, expected: "2001:db8::1"},
+}
+
+func TestTools_RealIP(t *testing.T) {
+	testTools := Tools{TrustedProxies: []string{"10.0.0.0/8", "::1"}}
+
+	var seen string
+	h := testTools.RealIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = ClientIP(r)
+	}))
+
+	for _, e := range realIPTests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = e.remoteAddr
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		if seen != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.testName, e.expected, seen)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Pagination holds what the client asked for
+// through the page, per_page and cursor query parameters
+type Pagination struct {
+	Page    int
+	PerPage int
+	Cursor  string
+}
+
+// Offset is the number of items to skip, handy for SQL OFFSET.
+// It's never negative, offsets too large for an int are capped
+func (p Pagination) Offset() int {
+	if p.Page < 1 || p.PerPage < 1 {
+		return 0
+	}
+
+	if p.Page-1 > math.MaxInt/p.PerPage {
+		return math.MaxInt
+	}
+
+	return (p.Page - 1) * p.PerPage
+}
+
+// PaginatedResponse is the JSONResponse of list endpoints
+type PaginatedResponse struct {
+	Error      bool        `json:"error"`
+	Message    string      `json:"message"`
+	Items      interface{} `json:"items"`
+	Page       int         `json:"page,omitempty"`
+	PerPage    int         `json:"per_page"`
+	Total      int         `json:"total"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
+}
+
+// ReadPagination parses page, per_page and cursor from the query string.
+// per_page defaults to DefaultPerPage (20) and is capped at MaxPerPage (100),
+// pages past MaxPage (100000) are refused
+func (t *Tools) ReadPagination(r *http.Request) (Pagination, error) {
+	defaultPerPage := 20
+	if t.DefaultPerPage != 0 {
+		defaultPerPage = t.DefaultPerPage
+	}
+
+	maxPerPage := 100
+	if t.MaxPerPage != 0 {
+		maxPerPage = t.MaxPerPage
+	}
+
+	maxPage := 100000
+	if t.MaxPage != 0 {
+		maxPage = t.MaxPage
+	}
+
+	query := r.URL.Query()
+
+	p := Pagination{
+		Page:    1,
+		PerPage: defaultPerPage,
+		Cursor:  query.Get("cursor"),
+	}
+
+	if s := query.Get("page"); s != "" {
+		page, err := strconv.Atoi(s)
+		if err != nil || page < 1 {
+			return p, errors.New("page must be a positive integer")
+		}
+		if page > maxPage {
+			return p, fmt.Errorf("page must not be larger than %d", maxPage)
+		}
+		p.Page = page
+	}
+
+	if s := query.Get("per_page"); s != "" {
+		perPage, err := strconv.Atoi(s)
+		if err != nil || perPage < 1 {
+			return p, errors.New("per_page must be a positive integer")
+		}
+		p.PerPage = perPage
+	}
+
+	if p.PerPage > maxPerPage {
+		p.PerPage = maxPerPage
+	}
+
+	return p, nil
+}
+
+// WritePaginatedJSON writes the page through WriteJSON, adding an
+// RFC 8288 Link header pointing to the first, prev, next and last pages.
+// Cursors win over page numbers when they're set
+func (t *Tools) WritePaginatedJSON(w http.ResponseWriter, r *http.Request, status int, page PaginatedResponse, headers ...http.Header) error {
+	if page.Items == nil {
+		// an empty list reads better than null
+		page.Items = []interface{}{}
+	}
+
+	var links []string
+	link := func(rel string, param string, value string) {
+		u := *r.URL
+		u.Scheme, u.Host = "", ""
+
+		q := u.Query()
+		if param == "cursor" {
+			q.Del("page")
+		} else {
+			q.Del("cursor")
+		}
+		q.Set(param, value)
+		u.RawQuery = q.Encode()
+
+		links = append(links, fmt.Sprintf("<%s>; rel=\"%s\"", u.String(), rel))
+	}
+
+	if page.NextCursor != "" || page.PrevCursor != "" {
+		if page.PrevCursor != "" {
+			link("prev", "cursor", page.PrevCursor)
+		}
+		if page.NextCursor != "" {
+			link("next", "cursor", page.NextCursor)
+		}
+	} else if page.Page > 0 && page.PerPage > 0 {
+		lastPage := (page.Total + page.PerPage - 1) / page.PerPage
+		if lastPage < 1 {
+			lastPage = 1
+		}
+
+		link("first", "page", "1")
+		if page.Page > 1 {
+			link("prev", "page", strconv.Itoa(page.Page-1))
+		}
+		if page.Page < lastPage {
+			link("next", "page", strconv.Itoa(page.Page+1))
+		}
+		link("last", "page", strconv.Itoa(lastPage))
+	}
+
+	h := make(http.Header)
+	if len(headers) > 0 {
+		h = headers[0].Clone()
+	}
+
+	if len(links) > 0 {
+		h.Set("Link", strings.Join(links, ", "))
+	}
+
+	return t.WriteJSON(w, status, page, h)
+}
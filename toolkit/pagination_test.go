@@ -0,0 +1,131 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var paginationTests = []struct {
+	testName        string
+	query           string
+	expectedPage    int
+	expectedPerPage int
+	expectedCursor  string
+	errorExpected   bool
+}{
+	{testName: "defaults", query: "", expectedPage: 1, expectedPerPage: 20},
+	{testName: "page and per_page", query: "page=3&per_page=50", expectedPage: 3, expectedPerPage: 50},
+	{testName: "per_page over the limit", query: "per_page=1000", expectedPage: 1, expectedPerPage: 100},
+	{testName: "cursor", query: "cursor=abc", expectedPage: 1, expectedPerPage: 20, expectedCursor: "abc"},
+	{testName: "page zero", query: "page=0", errorExpected: true},
+	{testName: "page not a number", query: "page=one", errorExpected: true},
+	{testName: "negative per_page", query: "per_page=-1", errorExpected: true},
+	{testName: "last page allowed", query: "page=100000", expectedPage: 100000, expectedPerPage: 20},
+	{testName: "page too large", query: "page=100001", errorExpected: true},
+	{testName: "page overflowing", query: "page=9223372036854775807", errorExpected: true},
+}
+
+var offsetTests = []struct {
+	testName   string
+	pagination Pagination
+	expected   int
+}{
+	{testName: "first page", pagination: Pagination{Page: 1, PerPage: 20}, expected: 0},
+	{testName: "third page", pagination: Pagination{Page: 3, PerPage: 20}, expected: 40},
+	{testName: "zero value", pagination: Pagination{}, expected: 0},
+	{testName: "negative per page", pagination: Pagination{Page: 3, PerPage: -20}, expected: 0},
+	{testName: "overflow", pagination: Pagination{Page: math.MaxInt, PerPage: 100}, expected: math.MaxInt},
+}
+
+func TestPagination_Offset(t *testing.T) {
+	for _, e := range offsetTests {
+		if offset := e.pagination.Offset(); offset != e.expected {
+			t.Errorf("%s: expected %d but got %d", e.testName, e.expected, offset)
+		}
+	}
+}
+
+func TestTools_ReadPagination(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range paginationTests {
+		req := httptest.NewRequest("GET", "/items?"+e.query, nil)
+
+		p, err := testTools.ReadPagination(req)
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected but none received", e.testName)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.testName, err.Error())
+		}
+
+		if p.Page != e.expectedPage || p.PerPage != e.expectedPerPage || p.Cursor != e.expectedCursor {
+			t.Errorf("%s: wrong pagination returned: %+v", e.testName, p)
+		}
+	}
+}
+
+var paginatedResponseTests = []struct {
+	testName     string
+	target       string
+	page         PaginatedResponse
+	expectedLink string
+}{
+	{
+		testName:     "middle page",
+		target:       "/items?page=2&per_page=10",
+		page:         PaginatedResponse{Page: 2, PerPage: 10, Total: 35},
+		expectedLink: `</items?page=1&per_page=10>; rel="first", </items?page=1&per_page=10>; rel="prev", </items?page=3&per_page=10>; rel="next", </items?page=4&per_page=10>; rel="last"`,
+	},
+	{
+		testName:     "only page",
+		target:       "/items",
+		page:         PaginatedResponse{Page: 1, PerPage: 10, Total: 3},
+		expectedLink: `</items?page=1>; rel="first", </items?page=1>; rel="last"`,
+	},
+	{
+		testName:     "cursors",
+		target:       "/items?cursor=b&page=4",
+		page:         PaginatedResponse{PerPage: 10, Total: 35, NextCursor: "c", PrevCursor: "a"},
+		expectedLink: `</items?cursor=a>; rel="prev", </items?cursor=c>; rel="next"`,
+	},
+}
+
+func TestTools_WritePaginatedJSON(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range paginatedResponseTests {
+		req := httptest.NewRequest("GET", e.target, nil)
+		rr := httptest.NewRecorder()
+
+		err := testTools.WritePaginatedJSON(rr, req, http.StatusOK, e.page)
+		if err != nil {
+			t.Errorf("%s: failed to write json: %v", e.testName, err)
+		}
+
+		if rr.Header().Get("Link") != e.expectedLink {
+			t.Errorf("%s: wrong Link header, expected %s but got %s", e.testName, e.expectedLink, rr.Header().Get("Link"))
+		}
+
+		var payload map[string]interface{}
+		err = json.NewDecoder(rr.Body).Decode(&payload)
+		if err != nil {
+			t.Errorf("%s: received an error decoding JSON: %v", e.testName, err)
+		}
+
+		if items, ok := payload["items"].([]interface{}); !ok || len(items) != 0 {
+			t.Errorf("%s: expected an empty items list but got %v", e.testName, payload["items"])
+		}
+
+		if payload["total"] != float64(e.page.Total) {
+			t.Errorf("%s: wrong total returned: %v", e.testName, payload["total"])
+		}
+	}
+}
@@ -0,0 +1,582 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrPatchTestFailed is wrapped by JSONPatchError when a "test" operation doesn't match
+var ErrPatchTestFailed = errors.New("test operation failed")
+
+// JSONPatchError tells which operation of a JSON Patch document failed, and why
+type JSONPatchError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *JSONPatchError) Error() string {
+	return fmt.Sprintf("patch operation %d (%s %s): %s", e.Index, e.Op, e.Path, e.Err.Error())
+}
+
+func (e *JSONPatchError) Unwrap() error {
+	return e.Err
+}
+
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  *string         `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ReadJSONPatch reads a JSON Patch document (RFC 6902) from the body
+// and applies it to target, which may be a pointer to a struct, map,
+// []byte or json.RawMessage. The body follows the same rules as ReadJSON,
+// except that members the operations don't define are ignored, as the RFC
+// asks, and the patched result honors AllowJSONUnknownFields. Nothing is
+// changed on target if any of the operations fail, and struct fields
+// JSON doesn't carry (unexported or tagged json:"-") keep their values
+func (t *Tools) ReadJSONPatch(w http.ResponseWriter, r *http.Request, target interface{}) error {
+	var raw json.RawMessage
+
+	err := t.ReadJSON(w, r, &raw)
+	if err != nil {
+		return err
+	}
+
+	// not through ReadJSON, unknown members must be ignored here
+	var ops []jsonPatchOperation
+
+	err = json.Unmarshal(raw, &ops)
+	if err != nil {
+		return jsonDecodeError(err, len(raw))
+	}
+
+	return t.patchTarget(target, func(doc interface{}) (interface{}, error) {
+		return applyJSONPatch(doc, ops)
+	})
+}
+
+// ReadMergePatch reads a JSON Merge Patch document (RFC 7396) from the body
+// and applies it to target, with the same rules as ReadJSONPatch
+func (t *Tools) ReadMergePatch(w http.ResponseWriter, r *http.Request, target interface{}) error {
+	var raw json.RawMessage
+
+	err := t.ReadJSON(w, r, &raw)
+	if err != nil {
+		return err
+	}
+
+	patch, err := decodeJSONValue(raw)
+	if err != nil {
+		return err
+	}
+
+	return t.patchTarget(target, func(doc interface{}) (interface{}, error) {
+		return mergePatch(doc, patch), nil
+	})
+}
+
+// turns target into a generic JSON value, lets apply work on it
+// and then stores the result back into target
+func (t *Tools) patchTarget(target interface{}, apply func(doc interface{}) (interface{}, error)) error {
+	var original []byte
+	var err error
+
+	switch v := target.(type) {
+	case *json.RawMessage:
+		original = *v
+	case *[]byte:
+		original = *v
+	default:
+		original, err = json.Marshal(target)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(original) == 0 {
+		original = []byte("null")
+	}
+
+	doc, err := decodeJSONValue(original)
+	if err != nil {
+		return err
+	}
+
+	doc, err = apply(doc)
+	if err != nil {
+		return err
+	}
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	switch v := target.(type) {
+	case *json.RawMessage:
+		*v = patched
+		return nil
+	case *[]byte:
+		*v = patched
+		return nil
+	}
+
+	// decode into a fresh value, so fields removed by the
+	// patch don't keep their old values around, then copy
+	// it over the original, which keeps what JSON doesn't carry
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("patch target must be a non-nil pointer")
+	}
+
+	fresh := reflect.New(rv.Elem().Type())
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	if !t.AllowJSONUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+
+	err = dec.Decode(fresh.Interface())
+	if err != nil {
+		return jsonDecodeError(err, len(patched))
+	}
+
+	result := reflect.New(rv.Elem().Type()).Elem()
+	result.Set(rv.Elem())
+	copyJSONFields(result, fresh.Elem())
+
+	rv.Elem().Set(result)
+
+	return nil
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// sets on dst what JSON carries from src, leaving unexported and json:"-"
+// fields of dst alone, in nested structs too. Other values are copied whole
+func copyJSONFields(dst, src reflect.Value) {
+	typ := dst.Type()
+
+	// types that marshal themselves, like time.Time, are one value for JSON
+	custom := reflect.PointerTo(typ).Implements(jsonMarshalerType) || reflect.PointerTo(typ).Implements(textMarshalerType)
+
+	switch {
+	case typ.Kind() == reflect.Struct && !custom:
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if (!field.IsExported() && !field.Anonymous) || field.Tag.Get("json") == "-" {
+				continue
+			}
+
+			if !dst.Field(i).CanSet() {
+				// an unexported embedded struct, its exported fields can still be set
+				if field.Type.Kind() == reflect.Struct {
+					copyJSONFields(dst.Field(i), src.Field(i))
+				}
+				continue
+			}
+
+			copyJSONFields(dst.Field(i), src.Field(i))
+		}
+
+	case typ.Kind() == reflect.Pointer && typ.Elem().Kind() == reflect.Struct && !dst.IsNil() && !src.IsNil():
+		// a new struct, so the original one isn't changed in place
+		p := reflect.New(typ.Elem())
+		p.Elem().Set(dst.Elem())
+		copyJSONFields(p.Elem(), src.Elem())
+		dst.Set(p)
+
+	default:
+		dst.Set(src)
+	}
+}
+
+// decodes keeping numbers as json.Number, so
+// big integers survive the round trip
+func decodeJSONValue(raw []byte) (interface{}, error) {
+	var v interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, jsonDecodeError(err, len(raw))
+	}
+
+	return v, nil
+}
+
+// mergePatch is straight from the pseudo code of RFC 7396
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for k, v := range patchObject {
+		if v == nil {
+			delete(targetObject, k)
+		} else {
+			targetObject[k] = mergePatch(targetObject[k], v)
+		}
+	}
+
+	return targetObject
+}
+
+func applyJSONPatch(doc interface{}, ops []jsonPatchOperation) (interface{}, error) {
+	for i, op := range ops {
+		var err error
+		doc, err = applyJSONPatchOperation(doc, op)
+		if err != nil {
+			return nil, &JSONPatchError{Index: i, Op: op.Op, Path: op.Path, Err: err}
+		}
+	}
+
+	return doc, nil
+}
+
+func applyJSONPatchOperation(doc interface{}, op jsonPatchOperation) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (interface{}, error) {
+		if op.Value == nil {
+			return nil, errors.New(`missing "value"`)
+		}
+		return decodeJSONValue(op.Value)
+	}
+
+	from := func() ([]string, error) {
+		if op.From == nil {
+			return nil, errors.New(`missing "from"`)
+		}
+		return parseJSONPointer(*op.From)
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, v)
+
+	case "remove":
+		return jsonPointerRemove(doc, path)
+
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := jsonPointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		doc, err = jsonPointerRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, v)
+
+	case "move":
+		fromPath, err := from()
+		if err != nil {
+			return nil, err
+		}
+		if isJSONPointerPrefix(fromPath, path) && len(fromPath) < len(path) {
+			return nil, errors.New("a value can't be moved into one of its children")
+		}
+		v, err := jsonPointerGet(doc, fromPath)
+		if err != nil {
+			return nil, err
+		}
+		doc, err = jsonPointerRemove(doc, fromPath)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, v)
+
+	case "copy":
+		fromPath, err := from()
+		if err != nil {
+			return nil, err
+		}
+		v, err := jsonPointerGet(doc, fromPath)
+		if err != nil {
+			return nil, err
+		}
+		// copies are deep, otherwise changing one
+		// side later would change the other too
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		v, err = decodeJSONValue(b)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, v)
+
+	case "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		current, err := jsonPointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonValuesEqual(current, v) {
+			return nil, ErrPatchTestFailed
+		}
+		return doc, nil
+
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// parses a JSON Pointer (RFC 6901) into its reference tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func isJSONPointerPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parses an array index, "-" means one past the end
+func jsonArrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+
+	// leading zeros aren't allowed by the RFC
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	last := length - 1
+	if allowEnd {
+		last = length
+	}
+
+	if i > last {
+		return 0, fmt.Errorf("array index %d out of bounds", i)
+	}
+
+	return i, nil
+}
+
+func jsonPointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			v, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("path member %q does not exist", token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := jsonArrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[i]
+		default:
+			return nil, fmt.Errorf("path member %q does not exist", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// walks down to the parent of the last token and lets fn change it,
+// fn returns the new parent since inserting into slices makes new ones
+func jsonPointerUpdate(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	token := path[0]
+
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		child, ok := container[token]
+		if !ok {
+			return nil, fmt.Errorf("path member %q does not exist", token)
+		}
+		child, err := jsonPointerUpdate(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[token] = child
+		return container, nil
+
+	case []interface{}:
+		i, err := jsonArrayIndex(token, len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := jsonPointerUpdate(container[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[i] = child
+		return container, nil
+
+	default:
+		return nil, fmt.Errorf("path member %q does not exist", token)
+	}
+}
+
+func jsonPointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return jsonPointerUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+
+		case []interface{}:
+			i, err := jsonArrayIndex(token, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[i+1:], container[i:])
+			container[i] = value
+			return container, nil
+
+		default:
+			return nil, fmt.Errorf("can't add %q to a non container value", token)
+		}
+	})
+}
+
+func jsonPointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	return jsonPointerUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := container[token]; !ok {
+				return nil, fmt.Errorf("path member %q does not exist", token)
+			}
+			delete(container, token)
+			return container, nil
+
+		case []interface{}:
+			i, err := jsonArrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:i], container[i+1:]...), nil
+
+		default:
+			return nil, fmt.Errorf("path member %q does not exist", token)
+		}
+	})
+}
+
+// compares two decoded JSON values, numbers are equal
+// if they have the same value, no matter how they were written
+func jsonValuesEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		return errX == nil && errY == nil && fx == fy
+
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !jsonValuesEqual(v, w) {
+				return false
+			}
+		}
+		return true
+
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonValuesEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,243 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type patchTestTarget struct {
+	Name  string   `json:"name"`
+	Age   int      `json:"age"`
+	Tags  []string `json:"tags"`
+	Email string   `json:"email,omitempty"`
+}
+
+var jsonPatchTests = []struct {
+	testName      string
+	patch         string
+	expected      patchTestTarget
+	errorExpected bool
+	testFailed    bool
+}{
+	{
+		testName: "replace",
+		patch:    `[{"op": "replace", "path": "/name", "value": "bob"}]`,
+		expected: patchTestTarget{Name: "bob", Age: 30, Tags: []string{"a", "b"}},
+	},
+	{
+		testName: "add to array and remove field",
+		patch:    `[{"op": "add", "path": "/tags/-", "value": "c"}, {"op": "add", "path": "/tags/0", "value": "z"}, {"op": "remove", "path": "/age"}]`,
+		expected: patchTestTarget{Name: "alice", Tags: []string{"z", "a", "b", "c"}},
+	},
+	{
+		testName: "move and copy",
+		patch:    `[{"op": "copy", "from": "/name", "path": "/email"}, {"op": "move", "from": "/tags/1", "path": "/tags/0"}]`,
+		expected: patchTestTarget{Name: "alice", Age: 30, Tags: []string{"b", "a"}, Email: "alice"},
+	},
+	{
+		testName: "passing test",
+		patch:    `[{"op": "test", "path": "/age", "value": 30.0}, {"op": "replace", "path": "/age", "value": 31}]`,
+		expected: patchTestTarget{Name: "alice", Age: 31, Tags: []string{"a", "b"}},
+	},
+	{
+		testName: "members operations don't define are ignored",
+		patch:    `[{"op": "test", "path": "/age", "value": 30, "x": 1}, {"op": "remove", "path": "/age", "value": "ignored", "from": "/name"}]`,
+		expected: patchTestTarget{Name: "alice", Tags: []string{"a", "b"}},
+	},
+	{
+		testName:      "failing test",
+		patch:         `[{"op": "replace", "path": "/age", "value": 31}, {"op": "test", "path": "/name", "value": "bob"}]`,
+		errorExpected: true,
+		testFailed:    true,
+	},
+	{
+		testName:      "remove missing path",
+		patch:         `[{"op": "remove", "path": "/missing"}]`,
+		errorExpected: true,
+	},
+	{
+		testName:      "index out of bounds",
+		patch:         `[{"op": "add", "path": "/tags/5", "value": "x"}]`,
+		errorExpected: true,
+	},
+	{
+		testName:      "unknown op",
+		patch:         `[{"op": "explode", "path": "/name"}]`,
+		errorExpected: true,
+	},
+	{
+		testName:      "unknown field in the result",
+		patch:         `[{"op": "add", "path": "/nickname", "value": "al"}]`,
+		errorExpected: true,
+	},
+	{
+		testName:      "not a patch document",
+		patch:         `{"name": "bob"}`,
+		errorExpected: true,
+	},
+}
+
+func TestTools_ReadJSONPatch(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range jsonPatchTests {
+		target := patchTestTarget{Name: "alice", Age: 30, Tags: []string{"a", "b"}}
+		original := target
+
+		req := httptest.NewRequest("PATCH", "/", strings.NewReader(e.patch))
+		rr := httptest.NewRecorder()
+
+		err := testTools.ReadJSONPatch(rr, req, &target)
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected but none received", e.testName)
+			}
+
+			if e.testFailed && !errors.Is(err, ErrPatchTestFailed) {
+				t.Errorf("%s: expected ErrPatchTestFailed but got %v", e.testName, err)
+			}
+
+			if target.Name != original.Name || target.Age != original.Age {
+				t.Errorf("%s: target changed by a failed patch: %+v", e.testName, target)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.testName, err.Error())
+			continue
+		}
+
+		got, _ := json.Marshal(target)
+		expected, _ := json.Marshal(e.expected)
+		if string(got) != string(expected) {
+			t.Errorf("%s: expected %s but got %s", e.testName, expected, got)
+		}
+	}
+}
+
+func TestTools_ReadJSONPatch_Error(t *testing.T) {
+	var testTools Tools
+
+	target := patchTestTarget{Name: "alice"}
+	req := httptest.NewRequest("PATCH", "/", strings.NewReader(`[{"op": "test", "path": "/name", "value": "alice"}, {"op": "remove", "path": "/nope"}]`))
+
+	err := testTools.ReadJSONPatch(httptest.NewRecorder(), req, &target)
+
+	var patchError *JSONPatchError
+	if !errors.As(err, &patchError) {
+		t.Fatalf("expected JSONPatchError but got %v", err)
+	}
+
+	if patchError.Index != 1 || patchError.Op != "remove" || patchError.Path != "/nope" {
+		t.Errorf("wrong operation reported: %+v", patchError)
+	}
+}
+
+var mergePatchTests = []struct {
+	testName string
+	target   string
+	patch    string
+	expected string
+}{
+	{testName: "replace member", target: `{"a":"b"}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+	{testName: "add member", target: `{"a":"b"}`, patch: `{"b":"c"}`, expected: `{"a":"b","b":"c"}`},
+	{testName: "remove member", target: `{"a":"b","b":"c"}`, patch: `{"a":null}`, expected: `{"b":"c"}`},
+	{testName: "replace array", target: `{"a":["b"]}`, patch: `{"a":["c","d"]}`, expected: `{"a":["c","d"]}`},
+	{testName: "nested", target: `{"a":{"b":"c","d":"e"}}`, patch: `{"a":{"d":null,"f":1}}`, expected: `{"a":{"b":"c","f":1}}`},
+	{testName: "replace document", target: `{"a":"b"}`, patch: `["c"]`, expected: `["c"]`},
+	{testName: "big numbers survive", target: `{"id":9007199254740993}`, patch: `{"a":"b"}`, expected: `{"a":"b","id":9007199254740993}`},
+}
+
+func TestTools_ReadMergePatch(t *testing.T) {
+	testTools := Tools{AllowJSONUnknownFields: true}
+
+	for _, e := range mergePatchTests {
+		target := json.RawMessage(e.target)
+
+		req := httptest.NewRequest("PATCH", "/", strings.NewReader(e.patch))
+		rr := httptest.NewRecorder()
+
+		err := testTools.ReadMergePatch(rr, req, &target)
+		if err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.testName, err.Error())
+			continue
+		}
+
+		if string(target) != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.testName, e.expected, target)
+		}
+	}
+}
+
+func TestTools_ReadMergePatch_Struct(t *testing.T) {
+	var testTools Tools
+
+	target := patchTestTarget{Name: "alice", Age: 30, Email: "alice@example.com"}
+
+	req := httptest.NewRequest("PATCH", "/", strings.NewReader(`{"age": 31, "email": null}`))
+
+	err := testTools.ReadMergePatch(httptest.NewRecorder(), req, &target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if target.Name != "alice" || target.Age != 31 || target.Email != "" {
+		t.Errorf("wrong target after merge patch: %+v", target)
+	}
+
+	req = httptest.NewRequest("PATCH", "/", strings.NewReader(`{"unknown": true}`))
+
+	err = testTools.ReadMergePatch(httptest.NewRecorder(), req, &target)
+	if err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Errorf("expected unknown key error but got %v", err)
+	}
+}
+
+type patchTestAccount struct {
+	Name     string `json:"name"`
+	Password string `json:"-"`
+	Profile  *patchTestProfile
+	loaded   bool
+}
+
+type patchTestProfile struct {
+	Bio    string `json:"bio"`
+	Secret string `json:"-"`
+}
+
+func TestTools_ReadMergePatch_Unserialized(t *testing.T) {
+	var testTools Tools
+
+	profile := &patchTestProfile{Bio: "hi", Secret: "s3"}
+	target := patchTestAccount{Name: "a", Password: "secret", Profile: profile, loaded: true}
+
+	req := httptest.NewRequest("PATCH", "/", strings.NewReader(`{"name": "b", "Profile": {"bio": "hello"}}`))
+
+	if err := testTools.ReadMergePatch(httptest.NewRecorder(), req, &target); err != nil {
+		t.Fatal(err)
+	}
+
+	// what JSON doesn't carry is kept
+	if target.Name != "b" || target.Password != "secret" || !target.loaded || target.Profile.Bio != "hello" || target.Profile.Secret != "s3" {
+		t.Errorf("wrong target after merge patch: %+v %+v", target, target.Profile)
+	}
+
+	if profile.Bio != "hi" {
+		t.Error("the original nested struct shouldn't be changed in place")
+	}
+
+	// removing still removes
+	req = httptest.NewRequest("PATCH", "/", strings.NewReader(`[{"op": "remove", "path": "/name"}, {"op": "remove", "path": "/Profile"}]`))
+
+	if err := testTools.ReadJSONPatch(httptest.NewRecorder(), req, &target); err != nil {
+		t.Fatal(err)
+	}
+
+	if target.Name != "" || target.Profile != nil || target.Password != "secret" {
+		t.Errorf("wrong target after removing: %+v", target)
+	}
+}
@@ -0,0 +1,103 @@
+package toolkit
+
+import (
+	"errors"
+	"strings"
+)
+
+// Alphabets for RandomStringFrom, RandomCode and Tools.RandomAlphabet
+const (
+	// AlphabetAlphanumeric is letters and digits only, safe anywhere
+	AlphabetAlphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// AlphabetURLSafe is the URL and filename safe base64 alphabet (RFC 4648)
+	AlphabetURLSafe = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	// AlphabetHex is lowercase hexadecimal
+	AlphabetHex = "0123456789abcdef"
+	// AlphabetCrockford is Crockford's base32, it leaves out I, L, O and U
+	// so codes can be read out loud and typed without confusion
+	AlphabetCrockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	// AlphabetNumeric is digits only, for PINs and OTPs
+	AlphabetNumeric = "0123456789"
+)
+
+// RandomStringFrom returns a random string of length characters taken from
+// alphabet, which may have from 1 to 256 characters. Every character has
+// the same chance of being picked
+func (t *Tools) RandomStringFrom(length int, alphabet string) (string, error) {
+	return randomString(length, alphabet)
+}
+
+// RandomPIN returns a random numeric code with the given number of digits, for OTPs and the like
+func (t *Tools) RandomPIN(digits int) (string, error) {
+	return randomString(digits, AlphabetNumeric)
+}
+
+// CodeFormat describes a human readable code like "ABCD-EFGH"
+type CodeFormat struct {
+	Groups    int
+	GroupSize int
+	Separator string
+	Alphabet  string
+}
+
+// InviteCodeFormat is two groups of four Crockford characters, like "7KQ2-M9XD"
+var InviteCodeFormat = CodeFormat{Groups: 2, GroupSize: 4, Separator: "-", Alphabet: AlphabetCrockford}
+
+// RandomCode returns a random code in the given format, zero values
+// fall back to InviteCodeFormat
+func (t *Tools) RandomCode(format CodeFormat) (string, error) {
+	if format.Groups == 0 {
+		format.Groups = InviteCodeFormat.Groups
+	}
+
+	if format.GroupSize == 0 {
+		format.GroupSize = InviteCodeFormat.GroupSize
+	}
+
+	if format.Separator == "" {
+		format.Separator = InviteCodeFormat.Separator
+	}
+
+	if format.Alphabet == "" {
+		format.Alphabet = InviteCodeFormat.Alphabet
+	}
+
+	if format.Groups < 0 || format.GroupSize < 0 {
+		return "", errors.New("code groups and group size must not be negative")
+	}
+
+	// one read for the whole code, then we cut it in groups
+	s, err := randomString(format.Groups*format.GroupSize, format.Alphabet)
+	if err != nil {
+		return "", err
+	}
+
+	r := []rune(s)
+	groups := make([]string, format.Groups)
+	for i := range groups {
+		groups[i] = string(r[i*format.GroupSize : (i+1)*format.GroupSize])
+	}
+
+	return strings.Join(groups, format.Separator), nil
+}
+
+// NormalizeCrockford cleans up a Crockford code typed by a person, so it can be
+// compared to the one we generated: separators and spaces are dropped, letters
+// are uppercased, O becomes 0 and I and L become 1, as the spec says
+func (t *Tools) NormalizeCrockford(code string) string {
+	var b strings.Builder
+
+	for _, c := range strings.ToUpper(code) {
+		switch c {
+		case '-', ' ', '_':
+			continue
+		case 'O':
+			c = '0'
+		case 'I', 'L':
+			c = '1'
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,184 @@
+package toolkit
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var alphabetTests = []struct {
+	testName string
+	alphabet string
+	pattern  string
+}{
+	{testName: "alphanumeric", alphabet: AlphabetAlphanumeric, pattern: `^[a-zA-Z0-9]{32}$`},
+	{testName: "url safe", alphabet: AlphabetURLSafe, pattern: `^[a-zA-Z0-9_-]{32}$`},
+	{testName: "hex", alphabet: AlphabetHex, pattern: `^[0-9a-f]{32}$`},
+	{testName: "crockford", alphabet: AlphabetCrockford, pattern: `^[0-9A-HJKMNP-TV-Z]{32}$`},
+	{testName: "numeric", alphabet: AlphabetNumeric, pattern: `^[0-9]{32}$`},
+	{testName: "custom", alphabet: "ab", pattern: `^[ab]{32}$`},
+	{testName: "unicode", alphabet: "αβγ", pattern: `^[αβγ]{32}$`},
+}
+
+func TestTools_RandomStringFrom(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range alphabetTests {
+		re := regexp.MustCompile(e.pattern)
+
+		for i := 0; i < 20; i++ {
+			s, err := testTools.RandomStringFrom(32, e.alphabet)
+			if err != nil {
+				t.Fatalf("%s: %v", e.testName, err)
+			}
+
+			if !re.MatchString(s) {
+				t.Errorf("%s: %q does not match %s", e.testName, s, e.pattern)
+			}
+		}
+	}
+
+	if _, err := testTools.RandomStringFrom(10, ""); err == nil {
+		t.Error("empty alphabet should fail")
+	}
+
+	if _, err := testTools.RandomStringFrom(10, strings.Repeat("a", 257)); err == nil {
+		t.Error("alphabet over 256 characters should fail")
+	}
+}
+
+func TestTools_RandomAlphabet(t *testing.T) {
+	testTools := Tools{RandomAlphabet: AlphabetHex}
+
+	s := testTools.RandomString(64)
+	if !regexp.MustCompile(`^[0-9a-f]{64}$`).MatchString(s) {
+		t.Errorf("RandomString should use RandomAlphabet, got %q", s)
+	}
+}
+
+var codeTests = []struct {
+	testName string
+	format   CodeFormat
+	pattern  string
+}{
+	{testName: "invite code", format: InviteCodeFormat, pattern: `^[0-9A-HJKMNP-TV-Z]{4}-[0-9A-HJKMNP-TV-Z]{4}$`},
+	{testName: "defaults", format: CodeFormat{}, pattern: `^[0-9A-HJKMNP-TV-Z]{4}-[0-9A-HJKMNP-TV-Z]{4}$`},
+	{testName: "custom", format: CodeFormat{Groups: 3, GroupSize: 2, Separator: " ", Alphabet: AlphabetNumeric}, pattern: `^[0-9]{2} [0-9]{2} [0-9]{2}$`},
+}
+
+func TestTools_RandomCode(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range codeTests {
+		code, err := testTools.RandomCode(e.format)
+		if err != nil {
+			t.Errorf("%s: %v", e.testName, err)
+			continue
+		}
+
+		if !regexp.MustCompile(e.pattern).MatchString(code) {
+			t.Errorf("%s: %q does not match %s", e.testName, code, e.pattern)
+		}
+	}
+
+	pin, err := testTools.RandomPIN(6)
+	if err != nil || !regexp.MustCompile(`^[0-9]{6}$`).MatchString(pin) {
+		t.Errorf("wrong pin returned: %q (%v)", pin, err)
+	}
+}
+
+func TestTools_NormalizeCrockford(t *testing.T) {
+	var testTools Tools
+
+	code, _ := testTools.RandomCode(InviteCodeFormat)
+
+	// what a person may type back
+	typed := strings.ToLower(strings.ReplaceAll(code, "-", " "))
+	if testTools.NormalizeCrockford(typed) != strings.ReplaceAll(code, "-", "") {
+		t.Errorf("normalized %q should match %q", typed, code)
+	}
+
+	if testTools.NormalizeCrockford("o1l-Io") != "01110" {
+		t.Errorf("ambiguous characters not normalized: %s", testTools.NormalizeCrockford("o1l-Io"))
+	}
+}
+
+func TestTools_RandomAlphabetInternalNames(t *testing.T) {
+	// an alphabet that would break paths and headers
+	testTools := Tools{RandomAlphabet: "/\n"}
+	safe := regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+	dir := t.TempDir()
+	if err := testTools.EnsureWritable(dir); err != nil {
+		t.Errorf("EnsureWritable: %v", err)
+	}
+
+	d, err := testTools.NewDeliveryQueue(dir).Enqueue("http://example.com", map[string]string{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !safe.MatchString(d.ID[strings.Index(d.ID, "-")+1:]) {
+		t.Errorf("unsafe delivery id %q", d.ID)
+	}
+
+	var key string
+	testTools.RetryPolicy = &RetryPolicy{MaxAttempts: 1, IdempotencyKeyHeader: "Idempotency-Key"}
+	testTools.HTTPClient = NewTestClient(func(request *http.Request) *http.Response {
+		key = request.Header.Get("Idempotency-Key")
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}")), Header: make(http.Header)}
+	})
+
+	if _, _, err := testTools.PushJSONToRemote("http://example.com", map[string]string{"foo": "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if !safe.MatchString(key) {
+		t.Errorf("unsafe idempotency key %q", key)
+	}
+}
+
+func TestTools_RandomAlphabetUploadNames(t *testing.T) {
+	// an alphabet that could climb out of the upload directory
+	testTools := Tools{RandomAlphabet: "/."}
+	safe := regexp.MustCompile(`^[a-zA-Z0-9]{10}$`)
+
+	for i := 0; i < 100; i++ {
+		name, err := testTools.newFileName()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !safe.MatchString(name) {
+			t.Fatalf("unsafe upload name %q", name)
+		}
+	}
+
+	// and the real thing, with the file renamed
+	fs := NewMemFS()
+	testTools.FS = fs
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "a.txt")
+	_, _ = part.Write([]byte("hello"))
+	_ = mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	files, err := testTools.UploadFiles(req, "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || !safe.MatchString(strings.TrimSuffix(files[0].NewFileName, ".txt")) {
+		t.Fatalf("unsafe upload %+v", files)
+	}
+
+	if _, err := fs.Stat("/uploads/" + files[0].NewFileName); err != nil {
+		t.Errorf("the upload should be in the upload directory: %v", err)
+	}
+}
@@ -0,0 +1,337 @@
+package toolkit
+
+import (
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is matched (with errors.Is) by the error RateLimit
+// answers with when a client runs out of requests
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitError is what RateLimit answers with, through ErrorJSONResponse
+type RateLimitError struct {
+	// how long until the client gets a request back
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RateLimit is a token bucket, Requests every Per on average with bursts of
+// up to Burst requests (Requests when zero). A zero Requests means no limit
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func (l RateLimit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+
+	return l.Requests
+}
+
+// tokens earned per second
+func (l RateLimit) rate() float64 {
+	per := l.Per
+	if per <= 0 {
+		per = time.Second
+	}
+
+	return float64(l.Requests) / per.Seconds()
+}
+
+// RateLimitResult is what a RateLimitStore says about a request
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// until the bucket is full again
+	Reset time.Duration
+	// until the next request is allowed, when this one wasn't
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the buckets, one per key. MemoryRateLimitStore
+// keeps them in memory, implement it to share them between instances
+type RateLimitStore interface {
+	// Take takes a request from the bucket of key, if there's one left
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// MemoryRateLimitStore keeps the buckets in memory, the zero value is ready to use.
+// Buckets that refilled are forgotten, they're the same as new ones. Past
+// MaxKeys the bucket closest to full is forgotten to make room, so memory
+// stays bounded when flooded with keys, every key is still limited and the
+// clients furthest from their limit back are the last to be forgotten
+type MemoryRateLimitStore struct {
+	// buckets kept at most (default 100000)
+	MaxKeys int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// the same buckets, the one full again soonest first
+	refills bucketHeap
+	// swapped in tests
+	now func() time.Time
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+	// when it's full again and can be forgotten
+	full time.Time
+	// position in the heap
+	index int
+}
+
+type bucketHeap []*bucket
+
+func (h bucketHeap) Len() int           { return len(h) }
+func (h bucketHeap) Less(i, j int) bool { return h[i].full.Before(h[j].full) }
+
+func (h bucketHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *bucketHeap) Push(x interface{}) {
+	b := x.(*bucket)
+	b.index = len(*h)
+	*h = append(*h, b)
+}
+
+func (h *bucketHeap) Pop() interface{} {
+	old := *h
+	b := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return b
+}
+
+func (s *MemoryRateLimitStore) maxKeys() int {
+	if s.MaxKeys > 0 {
+		return s.MaxKeys
+	}
+
+	return 100000
+}
+
+func (s *MemoryRateLimitStore) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+
+	return time.Now()
+}
+
+// Take implements RateLimitStore
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+	burst := float64(limit.burst())
+	rate := limit.rate()
+
+	if s.buckets == nil {
+		s.buckets = make(map[string]*bucket)
+	}
+
+	// each bucket is popped once, so this is cheap however many there are
+	for len(s.refills) > 0 && !s.refills[0].full.After(now) {
+		b := heap.Pop(&s.refills).(*bucket)
+		delete(s.buckets, b.key)
+	}
+
+	b, kept := s.buckets[key]
+	if !kept {
+		b = &bucket{key: key, tokens: burst, last: now}
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	result := RateLimitResult{Limit: limit.burst()}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((burst - b.tokens) / rate)
+	b.full = now.Add(result.Reset)
+
+	switch {
+	case kept:
+		heap.Fix(&s.refills, b.index)
+
+	default:
+		// the one losing the least, it was about to be forgotten anyway
+		if len(s.buckets) >= s.maxKeys() {
+			oldest := heap.Pop(&s.refills).(*bucket)
+			delete(s.buckets, oldest.key)
+		}
+
+		s.buckets[key] = b
+		heap.Push(&s.refills, b)
+	}
+
+	return result, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// RateLimitKey tells which bucket a request takes from. An empty key
+// falls back to the client ip
+type RateLimitKey func(r *http.Request) string
+
+// KeyByIP keys requests by ClientIP, so put RealIP before RateLimit when behind proxies
+func KeyByIP(r *http.Request) string {
+	return "ip:" + ClientIP(r)
+}
+
+// KeyByHeader keys requests by the value of a header, like a tenant id
+func KeyByHeader(name string) RateLimitKey {
+	return func(r *http.Request) string {
+		value := r.Header.Get(name)
+		if value == "" {
+			return ""
+		}
+
+		return "header:" + strings.ToLower(name) + ":" + value
+	}
+}
+
+// KeyByAPIKey keys requests by the API key in the X-API-Key header, or the
+// bearer token in Authorization. Keys are hashed, so stores never see them
+func KeyByAPIKey(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		auth := r.Header.Get("Authorization")
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+			key = strings.TrimSpace(auth[7:])
+		}
+	}
+
+	if key == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	return "apikey:" + hex.EncodeToString(sum[:16])
+}
+
+// RateLimitOptions configure the RateLimit middleware
+type RateLimitOptions struct {
+	// limit for requests that match none of Routes
+	Limit RateLimit
+	// limits by path, matched like http.ServeMux patterns: "/upload" is
+	// that path only and "/files/" everything under it, the longest wins.
+	// Each route has its own buckets
+	Routes map[string]RateLimit
+	// which bucket a request takes from, KeyByIP when nil
+	Key RateLimitKey
+	// where buckets are kept, a new MemoryRateLimitStore when nil
+	Store RateLimitStore
+}
+
+// RateLimit answers clients that ran out of requests with a 429 through
+// ErrorJSONResponse and a Retry-After header. Every limited response gets
+// the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+// When the store fails the request goes through, and the error is logged
+func (t *Tools) RateLimit(options RateLimitOptions) Middleware {
+	key := options.Key
+	if key == nil {
+		key = KeyByIP
+	}
+
+	store := options.Store
+	if store == nil {
+		store = &MemoryRateLimitStore{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, limit := options.route(r.URL.Path)
+			if limit.Requests <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			k := key(r)
+			if k == "" {
+				k = KeyByIP(r)
+			}
+
+			result, err := store.Take(r.Context(), route+" "+k, limit)
+			if err != nil {
+				t.logger().WarnContext(r.Context(), "rate limit store failed",
+					slog.String("error", err.Error()),
+					slog.String("request_id", RequestIDFromContext(r.Context())),
+				)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+
+			if !result.Allowed {
+				h.Set("Retry-After", ceilSeconds(result.RetryAfter))
+				_ = t.ErrorJSONResponse(w, &RateLimitError{RetryAfter: result.RetryAfter})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// the route pattern matching path and its limit
+func (o RateLimitOptions) route(path string) (string, RateLimit) {
+	pattern, limit := "", o.Limit
+
+	for p, l := range o.Routes {
+		matches := p == path || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p))
+		if matches && len(p) > len(pattern) {
+			pattern, limit = p, l
+		}
+	}
+
+	return pattern, limit
+}
+
+// headers count whole seconds, rounded up so clients don't come back too early
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,187 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore_Take(t *testing.T) {
+	now := time.Now()
+	store := &MemoryRateLimitStore{now: func() time.Time { return now }}
+
+	// 1 per second, bursts of 3
+	limit := RateLimit{Requests: 1, Per: time.Second, Burst: 3}
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		result, _ := store.Take(ctx, "a", limit)
+		if !result.Allowed || result.Remaining != i || result.Limit != 3 {
+			t.Fatalf("expected allowed with %d remaining, got %+v", i, result)
+		}
+	}
+
+	result, _ := store.Take(ctx, "a", limit)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Errorf("expected to be limited for a second, got %+v", result)
+	}
+
+	// other keys have their own bucket
+	if result, _ := store.Take(ctx, "b", limit); !result.Allowed {
+		t.Error("another key should be allowed")
+	}
+
+	// refills over time
+	now = now.Add(1500 * time.Millisecond)
+
+	if result, _ := store.Take(ctx, "a", limit); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("expected a token back, got %+v", result)
+	}
+}
+
+func TestMemoryRateLimitStore_Eviction(t *testing.T) {
+	now := time.Now()
+	store := &MemoryRateLimitStore{MaxKeys: 10, now: func() time.Time { return now }}
+	limit := RateLimit{Requests: 1, Per: time.Second, Burst: 5}
+	ctx := context.Background()
+
+	// a client that used its whole burst, it takes 5 seconds to refill
+	for i := 0; i < 5; i++ {
+		_, _ = store.Take(ctx, "limited", limit)
+	}
+
+	// a flood of new keys, each refilling in a second
+	for i := 0; i < 50; i++ {
+		if result, _ := store.Take(ctx, fmt.Sprint(i), limit); !result.Allowed {
+			t.Fatalf("a new key should be allowed, got %+v", result)
+		}
+	}
+
+	if len(store.buckets) != 10 || len(store.refills) != 10 {
+		t.Errorf("expected 10 buckets but got %d (%d)", len(store.buckets), len(store.refills))
+	}
+
+	if result, _ := store.Take(ctx, "limited", limit); result.Allowed {
+		t.Error("the limited client should still be limited")
+	}
+
+	// new keys are still limited, even with the store full
+	for i := 0; i < 5; i++ {
+		_, _ = store.Take(ctx, "flooder", limit)
+	}
+
+	if result, _ := store.Take(ctx, "flooder", limit); result.Allowed {
+		t.Error("a new key should be limited once it used its burst")
+	}
+
+	// full buckets are forgotten
+	now = now.Add(10 * time.Second)
+	_, _ = store.Take(ctx, "new", limit)
+
+	if len(store.buckets) != 1 || len(store.refills) != 1 {
+		t.Errorf("expected only the new bucket but got %d (%d)", len(store.buckets), len(store.refills))
+	}
+}
+
+var rateLimitKeyTests = []struct {
+	testName string
+	key      RateLimitKey
+	headers  map[string]string
+	expected string
+}{
+	{testName: "ip", key: KeyByIP, expected: "ip:192.0.2.1"},
+	{testName: "header", key: KeyByHeader("X-Tenant"), headers: map[string]string{"X-Tenant": "acme"}, expected: "header:x-tenant:acme"},
+	{testName: "missing header", key: KeyByHeader("X-Tenant"), expected: ""},
+	{testName: "api key", key: KeyByAPIKey, headers: map[string]string{"X-API-Key": "secret"}, expected: "apikey:2bb80d537b1da3e38bd30361aa855686"},
+	{testName: "bearer token", key: KeyByAPIKey, headers: map[string]string{"Authorization": "Bearer secret"}, expected: "apikey:2bb80d537b1da3e38bd30361aa855686"},
+	{testName: "basic auth", key: KeyByAPIKey, headers: map[string]string{"Authorization": "Basic c2VjcmV0"}, expected: ""},
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	for _, e := range rateLimitKeyTests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+
+		if key := e.key(req); key != e.expected {
+			t.Errorf("%s: expected %q but got %q", e.testName, e.expected, key)
+		}
+	}
+}
+
+func TestTools_RateLimit(t *testing.T) {
+	var testTools Tools
+
+	h := testTools.RateLimit(RateLimitOptions{
+		Limit: RateLimit{Requests: 2, Per: time.Minute},
+		Routes: map[string]RateLimit{
+			"/upload": {Requests: 1, Per: time.Minute},
+			"/files/": {},
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("/upload", "203.0.113.1:1234")
+	if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "1" || rr.Header().Get("RateLimit-Remaining") != "0" || rr.Header().Get("RateLimit-Reset") != "60" {
+		t.Errorf("wrong first response: %d %v", rr.Code, rr.Header())
+	}
+
+	rr = do("/upload", "203.0.113.1:1234")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "60" {
+		t.Errorf("expected a 429 with Retry-After, got %d %v", rr.Code, rr.Header())
+	}
+
+	if !strings.Contains(rr.Body.String(), `"error":true`) {
+		t.Errorf("expected a json error, got %s", rr.Body.String())
+	}
+
+	// another client, route and an unlimited route
+	if rr := do("/upload", "203.0.113.2:1234"); rr.Code != http.StatusOK {
+		t.Errorf("another ip should be allowed, got %d", rr.Code)
+	}
+
+	if rr := do("/other", "203.0.113.1:1234"); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "2" {
+		t.Errorf("the default limit should apply to other paths, got %d %v", rr.Code, rr.Header())
+	}
+
+	for i := 0; i < 5; i++ {
+		if rr := do("/files/a.png", "203.0.113.1:1234"); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("/files/ shouldn't be limited, got %d %v", rr.Code, rr.Header())
+		}
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store down")
+}
+
+func TestTools_RateLimitStoreFailure(t *testing.T) {
+	var testTools Tools
+
+	h := testTools.RateLimit(RateLimitOptions{
+		Limit: RateLimit{Requests: 1, Per: time.Minute},
+		Store: failingStore{},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("requests should go through when the store fails, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,157 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RequestSigner signs an outbound request, body is the exact payload being
+// sent. Implement it for whatever scheme a remote service wants
+type RequestSigner interface {
+	Sign(request *http.Request, body []byte) error
+}
+
+// RequestSignerFunc lets a plain function be used as a RequestSigner
+type RequestSignerFunc func(request *http.Request, body []byte) error
+
+func (f RequestSignerFunc) Sign(request *http.Request, body []byte) error {
+	return f(request, body)
+}
+
+// RequestOption customizes a single outbound call
+type RequestOption func(o *requestOptions)
+
+type requestOptions struct {
+	client  *http.Client
+	header  http.Header
+	signers []RequestSigner
+}
+
+// WithClient sends the call through client instead of Tools.HTTPClient
+func WithClient(client *http.Client) RequestOption {
+	return func(o *requestOptions) {
+		o.client = client
+	}
+}
+
+// WithHeader adds a header to the call
+func WithHeader(key, value string) RequestOption {
+	return func(o *requestOptions) {
+		if o.header == nil {
+			o.header = make(http.Header)
+		}
+		o.header.Add(key, value)
+	}
+}
+
+// WithBearerToken sends "Authorization: Bearer <token>"
+func WithBearerToken(token string) RequestOption {
+	return func(o *requestOptions) {
+		if o.header == nil {
+			o.header = make(http.Header)
+		}
+		o.header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// WithBasicAuth sends the username and password with HTTP Basic Authentication
+func WithBasicAuth(username, password string) RequestOption {
+	return WithSigner(RequestSignerFunc(func(request *http.Request, body []byte) error {
+		request.SetBasicAuth(username, password)
+		return nil
+	}))
+}
+
+// WithSigner signs the call with signer, after all headers are set
+func WithSigner(signer RequestSigner) RequestOption {
+	return func(o *requestOptions) {
+		o.signers = append(o.signers, signer)
+	}
+}
+
+// WithHMACSignature signs the call the webhook way, see HMACSigner
+func WithHMACSignature(secret []byte) RequestOption {
+	return WithSigner(&HMACSigner{Secret: secret})
+}
+
+// HMACSigner signs requests webhook style: it sends the current unix time in
+// TimestampHeader and "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))
+// in SignatureHeader. Signing the timestamp along with the body means an
+// old request can't be replayed with a fresh timestamp
+type HMACSigner struct {
+	Secret []byte
+	// default X-Signature
+	SignatureHeader string
+	// default X-Timestamp
+	TimestampHeader string
+	// swapped in tests
+	now func() time.Time
+}
+
+func (s *HMACSigner) Sign(request *http.Request, body []byte) error {
+	signatureHeader := s.SignatureHeader
+	if signatureHeader == "" {
+		signatureHeader = "X-Signature"
+	}
+
+	timestampHeader := s.TimestampHeader
+	if timestampHeader == "" {
+		timestampHeader = "X-Timestamp"
+	}
+
+	now := time.Now()
+	if s.now != nil {
+		now = s.now()
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	request.Header.Set(timestampHeader, timestamp)
+	request.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(computeHMAC(s.Secret, timestamp, body)))
+
+	return nil
+}
+
+// HMAC-SHA256 of timestamp + "." + body
+func computeHMAC(secret []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return mac.Sum(nil)
+}
+
+// applies the options to the request, and returns the client to send it with
+func (t *Tools) applyRequestOptions(request *http.Request, body []byte, opts []RequestOption) (*http.Client, error) {
+	var o requestOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// the id of the request we're serving, if it came through
+	// RequestID, so the call can be traced back to it
+	if id := RequestIDFromContext(request.Context()); id != "" {
+		request.Header.Set(RequestIDHeader, id)
+	}
+
+	for k, v := range o.header {
+		request.Header[k] = v
+	}
+
+	for _, signer := range o.signers {
+		if err := signer.Sign(request, body); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.client != nil {
+		return o.client, nil
+	}
+
+	return t.httpClient(), nil
+}
@@ -0,0 +1,105 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTools_SendJSON_Options(t *testing.T) {
+	var sent *http.Request
+
+	testTools := Tools{
+		HTTPClient: NewTestClient(func(request *http.Request) *http.Response {
+			sent = request
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBufferString("{}")),
+				Header:     make(http.Header),
+			}
+		}),
+	}
+
+	_, err := testTools.PostJSON("http://example.com/some/path", map[string]string{"foo": "bar"}, nil,
+		WithHeader("X-Tenant", "acme"),
+		WithBearerToken("secret-token"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent.Header.Get("X-Tenant") != "acme" {
+		t.Errorf("custom header not sent, got %q", sent.Header.Get("X-Tenant"))
+	}
+
+	if sent.Header.Get("Authorization") != "Bearer secret-token" {
+		t.Errorf("wrong authorization header: %q", sent.Header.Get("Authorization"))
+	}
+
+	if sent.Header.Get("Content-Type") != "application/json" {
+		t.Error("content type should still be set")
+	}
+
+	_, err = testTools.GetJSON("http://example.com/some/path", nil, WithBasicAuth("user", "pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	username, password, ok := sent.BasicAuth()
+	if !ok || username != "user" || password != "pass" {
+		t.Errorf("wrong basic auth sent: %s %s", username, password)
+	}
+}
+
+func TestTools_PushJSONToRemote_Signer(t *testing.T) {
+	var sent *http.Request
+	var sentBody []byte
+
+	client := NewTestClient(func(request *http.Request) *http.Response {
+		sent = request
+		sentBody, _ = io.ReadAll(request.Body)
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewBufferString("ok")),
+			Header:     make(http.Header),
+		}
+	})
+
+	var testTools Tools
+
+	signer := &HMACSigner{
+		Secret: []byte("shhh"),
+		now:    func() time.Time { return time.Unix(1688817600, 0) },
+	}
+
+	_, _, err := testTools.PushJSONToRemoteContext(context.Background(), "http://example.com/hook", map[string]string{"foo": "bar"}, WithClient(client), WithSigner(signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent.Header.Get("X-Timestamp") != "1688817600" {
+		t.Errorf("wrong timestamp sent: %q", sent.Header.Get("X-Timestamp"))
+	}
+
+	expected := "sha256=" + hex.EncodeToString(computeHMAC([]byte("shhh"), "1688817600", sentBody))
+	if sent.Header.Get("X-Signature") != expected {
+		t.Errorf("wrong signature, expected %s but got %s", expected, sent.Header.Get("X-Signature"))
+	}
+
+	// a custom scheme plugged in through the interface
+	failing := RequestSignerFunc(func(request *http.Request, body []byte) error {
+		return errors.New("no key for this service")
+	})
+
+	_, _, err = testTools.PushJSONToRemoteContext(context.Background(), "http://example.com/hook", map[string]string{"foo": "bar"}, WithClient(client), WithSigner(failing))
+	if err == nil || err.Error() != "no key for this service" {
+		t.Errorf("expected signer error but got %v", err)
+	}
+}
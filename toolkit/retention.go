@@ -0,0 +1,165 @@
+package toolkit
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy says which files in a directory are kept, zero values mean no limit
+type RetentionPolicy struct {
+	// files modified longer ago than this are removed, like 30 * 24 * time.Hour
+	MaxAge time.Duration
+	// the oldest files are removed until the rest fits in this many bytes
+	MaxTotalSize int64
+	// the oldest files are removed until only this many are left
+	MaxFiles int
+	// reports what would be removed, without removing anything
+	DryRun bool
+}
+
+// RemovedFile is a file removed by EnforceRetention, and why
+type RemovedFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// "age", "count" or "size", the first limit it went over
+	Reason string `json:"reason"`
+}
+
+// RetentionReport is what a retention run did, or would do on a dry run
+type RetentionReport struct {
+	Dir          string        `json:"dir"`
+	DryRun       bool          `json:"dry_run"`
+	Removed      []RemovedFile `json:"removed"`
+	RemovedBytes int64         `json:"removed_bytes"`
+	KeptFiles    int           `json:"kept_files"`
+	KeptBytes    int64         `json:"kept_bytes"`
+}
+
+// EnforceRetention removes the files in dir that the policy doesn't keep:
+// first the ones too old, then the oldest ones until MaxFiles and
+// MaxTotalSize are respected. It's meant for directories filled by
+// UploadFiles, so subdirectories and hidden files are left alone. Files
+// that fail to be removed don't stop the run, their errors are returned
+// together with the report
+func (t *Tools) EnforceRetention(dir string, policy RetentionPolicy) (*RetentionReport, error) {
+	entries, err := t.fs().ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []RemovedFile
+	var totalSize int64
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		files = append(files, RemovedFile{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+		totalSize += info.Size()
+	}
+
+	// oldest first, that's the order they're evicted in
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].ModTime.Equal(files[j].ModTime) {
+			return files[i].ModTime.Before(files[j].ModTime)
+		}
+		return files[i].Name < files[j].Name
+	})
+
+	report := &RetentionReport{Dir: dir, DryRun: policy.DryRun, Removed: []RemovedFile{}}
+	cutoff := time.Now().Add(-policy.MaxAge)
+	count := len(files)
+
+	var errs []error
+	for _, f := range files {
+		switch {
+		case policy.MaxAge > 0 && f.ModTime.Before(cutoff):
+			f.Reason = "age"
+		case policy.MaxFiles > 0 && count > policy.MaxFiles:
+			f.Reason = "count"
+		case policy.MaxTotalSize > 0 && totalSize > policy.MaxTotalSize:
+			f.Reason = "size"
+		default:
+			// the rest is newer, so it's all kept
+			report.KeptFiles++
+			report.KeptBytes += f.Size
+			continue
+		}
+
+		if !policy.DryRun {
+			if err := t.fs().Remove(filepath.Join(dir, f.Name)); err != nil {
+				errs = append(errs, err)
+				report.KeptFiles++
+				report.KeptBytes += f.Size
+				continue
+			}
+		}
+
+		report.Removed = append(report.Removed, f)
+		report.RemovedBytes += f.Size
+		count--
+		totalSize -= f.Size
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// StartRetention runs EnforceRetention on dir right away and then every
+// interval, in the background, handing each report to fn (which may be nil).
+// With an interval of zero or less it runs only once. The returned func
+// stops it, waiting for a run in progress to finish
+func (t *Tools) StartRetention(dir string, policy RetentionPolicy, interval time.Duration, fn func(*RetentionReport, error)) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	run := func() {
+		report, err := t.EnforceRetention(dir, policy)
+		if fn != nil {
+			fn(report, err)
+		}
+	}
+
+	go func() {
+		defer close(finished)
+
+		run()
+		if interval <= 0 {
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package toolkit
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// an uploads directory with a file per age in days, each one 100 bytes
+func testUploads(t *testing.T, days ...int) *MemFS {
+	t.Helper()
+
+	memFS := NewMemFS()
+	_ = memFS.MkdirAll("/uploads/sub", 0755)
+	_ = memFS.WriteFile("/uploads/.write-test", nil, 0644)
+
+	for _, d := range days {
+		name := "/uploads/" + string(rune('a'+d)) + ".png"
+		if err := memFS.WriteFile(name, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_ = memFS.Chtimes(name, time.Now().Add(-time.Duration(d)*24*time.Hour))
+	}
+
+	return memFS
+}
+
+var retentionTests = []struct {
+	testName string
+	policy   RetentionPolicy
+	removed  []string
+	reasons  []string
+}{
+	{testName: "nothing to do", policy: RetentionPolicy{}, removed: nil},
+	{testName: "max age", policy: RetentionPolicy{MaxAge: 7 * 24 * time.Hour}, removed: []string{"k.png", "i.png"}, reasons: []string{"age", "age"}},
+	{testName: "max files", policy: RetentionPolicy{MaxFiles: 3}, removed: []string{"k.png", "i.png"}, reasons: []string{"count", "count"}},
+	{testName: "max size", policy: RetentionPolicy{MaxTotalSize: 250}, removed: []string{"k.png", "i.png", "f.png"}, reasons: []string{"size", "size", "size"}},
+	{testName: "combined", policy: RetentionPolicy{MaxAge: 9 * 24 * time.Hour, MaxFiles: 3, MaxTotalSize: 100}, removed: []string{"k.png", "i.png", "f.png", "c.png"}, reasons: []string{"age", "count", "size", "size"}},
+}
+
+func TestTools_EnforceRetention(t *testing.T) {
+	for _, e := range retentionTests {
+		// 10, 8, 5, 2 and 1 days old
+		memFS := testUploads(t, 10, 8, 5, 2, 1)
+		testTools := Tools{FS: memFS}
+
+		report, err := testTools.EnforceRetention("/uploads", e.policy)
+		if err != nil {
+			t.Fatalf("%s: %v", e.testName, err)
+		}
+
+		if len(report.Removed) != len(e.removed) {
+			t.Fatalf("%s: expected %v removed but got %+v", e.testName, e.removed, report.Removed)
+		}
+
+		for i, f := range report.Removed {
+			if f.Name != e.removed[i] || f.Reason != e.reasons[i] {
+				t.Errorf("%s: expected %s (%s) but got %s (%s)", e.testName, e.removed[i], e.reasons[i], f.Name, f.Reason)
+			}
+
+			if _, err := memFS.Stat("/uploads/" + f.Name); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s: %s should be removed", e.testName, f.Name)
+			}
+		}
+
+		if report.KeptFiles != 5-len(e.removed) || report.RemovedBytes != int64(100*len(e.removed)) {
+			t.Errorf("%s: wrong totals: %+v", e.testName, report)
+		}
+
+		// hidden files and directories are never touched
+		for _, name := range []string{"/uploads/.write-test", "/uploads/sub"} {
+			if _, err := memFS.Stat(name); err != nil {
+				t.Errorf("%s: %s should be left alone", e.testName, name)
+			}
+		}
+	}
+}
+
+func TestTools_EnforceRetentionDryRun(t *testing.T) {
+	memFS := testUploads(t, 10, 1)
+	testTools := Tools{FS: memFS}
+
+	report, err := testTools.EnforceRetention("/uploads", RetentionPolicy{MaxFiles: 1, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.DryRun || len(report.Removed) != 1 || report.Removed[0].Name != "k.png" {
+		t.Errorf("wrong dry run report: %+v", report)
+	}
+
+	if _, err := memFS.Stat("/uploads/k.png"); err != nil {
+		t.Error("a dry run should not remove anything")
+	}
+}
+
+func TestTools_StartRetention(t *testing.T) {
+	memFS := testUploads(t, 10)
+	testTools := Tools{FS: memFS}
+
+	var mu sync.Mutex
+	var runs []*RetentionReport
+
+	stop := testTools.StartRetention("/uploads", RetentionPolicy{MaxAge: 24 * time.Hour}, 10*time.Millisecond, func(r *RetentionReport, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		runs = append(runs, r)
+	})
+
+	// the first run removes the old file, a later one a file that got old meanwhile
+	eventually(t, "the first run", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(runs) >= 1
+	})
+
+	_ = memFS.WriteFile("/uploads/new.png", make([]byte, 10), 0644)
+	_ = memFS.Chtimes("/uploads/new.png", time.Now().Add(-48*time.Hour))
+
+	eventually(t, "the new file removed", func() bool {
+		_, err := memFS.Stat("/uploads/new.png")
+		return errors.Is(err, fs.ErrNotExist)
+	})
+
+	stop()
+	stop()
+
+	mu.Lock()
+	count := len(runs)
+	first := runs[0]
+	mu.Unlock()
+
+	if len(first.Removed) != 1 || first.Removed[0].Name != "k.png" {
+		t.Errorf("wrong first run: %+v", first)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(runs) != count {
+		t.Error("no runs should happen after stop")
+	}
+}
+
+func TestTools_StartRetentionOnce(t *testing.T) {
+	testTools := Tools{FS: testUploads(t, 10)}
+
+	var runs int32
+	stop := testTools.StartRetention("/uploads", RetentionPolicy{MaxAge: 24 * time.Hour}, 0, func(r *RetentionReport, err error) {
+		atomic.AddInt32(&runs, 1)
+	})
+
+	// waits for the only run
+	stop()
+
+	if atomic.LoadInt32(&runs) != 1 {
+		t.Errorf("expected a single run but got %d", runs)
+	}
+}
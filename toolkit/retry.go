@@ -0,0 +1,188 @@
+package toolkit
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy tells outbound calls (SendJSON, PushJSONToRemote)
+// how to retry transient failures. Zero values fall back to
+// the defaults noted on each field
+type RetryPolicy struct {
+	// total number of attempts, including the first one (default 3)
+	MaxAttempts int
+	// wait before the first retry, doubled on each one after (default 100ms)
+	InitialBackoff time.Duration
+	// the longest wait between attempts (default 5s). A Retry-After
+	// longer than this makes us give up instead of waiting
+	MaxBackoff time.Duration
+	// status codes worth another try (default 429, 502, 503 and 504)
+	RetryableStatus []int
+	// tells if an error from the transport is worth another try,
+	// by default timeouts, connection resets/refusals and unexpected EOFs are
+	RetryableError func(err error) bool
+	// when set a random key is sent in this header (usually "Idempotency-Key"),
+	// the same one on every attempt, so the remote can drop duplicated POSTs
+	IdempotencyKeyHeader string
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+
+	return 3
+}
+
+func (p *RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff > 0 {
+		return p.MaxBackoff
+	}
+
+	return 5 * time.Second
+}
+
+// backoff grows exponentially and gets a jitter so a bunch of
+// clients failing at the same time don't all come back together
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+
+	d := initial << uint(retry)
+	if d <= 0 || d > p.maxBackoff() {
+		// the shift may overflow after many retries
+		d = p.maxBackoff()
+	}
+
+	// "equal jitter": half fixed, half random
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (p *RetryPolicy) retryableStatus(status int) bool {
+	codes := p.RetryableStatus
+	if len(codes) == 0 {
+		codes = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+
+	for _, code := range codes {
+		if code == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *RetryPolicy) retryableError(err error) bool {
+	if p.RetryableError != nil {
+		return p.RetryableError(err)
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED):
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	default:
+		return false
+	}
+}
+
+// parses Retry-After, which is either a number of seconds or an HTTP date
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		d := date.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// do sends the request with the client, retrying it according
+// to RetryPolicy. The request body must be rewindable (GetBody set),
+// which is always the case for the bytes readers we build
+func (t *Tools) do(client *http.Client, request *http.Request) (*http.Response, error) {
+	policy := t.RetryPolicy
+	if policy == nil {
+		return t.send(client, request)
+	}
+
+	if policy.IdempotencyKeyHeader != "" && request.Header.Get(policy.IdempotencyKeyHeader) == "" {
+		// a header value, whatever RandomAlphabet is
+		key, err := randomString(32, AlphabetAlphanumeric)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set(policy.IdempotencyKeyHeader, key)
+	}
+
+	for attempt := 1; ; attempt++ {
+		req := request.Clone(request.Context())
+		if request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		response, err := t.send(client, req)
+
+		last := attempt >= policy.maxAttempts() || request.Context().Err() != nil
+		if err != nil {
+			if last || !policy.retryableError(err) {
+				return nil, err
+			}
+		} else if last || !policy.retryableStatus(response.StatusCode) {
+			return response, nil
+		}
+
+		wait := policy.backoff(attempt - 1)
+		if response != nil {
+			if d, ok := retryAfter(response.Header.Get("Retry-After"), time.Now()); ok {
+				if d > policy.maxBackoff() {
+					// the remote wants us gone for longer
+					// than we are willing to wait
+					return response, nil
+				}
+				wait = d
+			}
+
+			// the connection can only be reused if
+			// the body is read to the end
+			_, _ = io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		}
+	}
+}
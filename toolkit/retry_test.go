@@ -0,0 +1,131 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var retryTests = []struct {
+	testName         string
+	statuses         []int
+	retryAfter       string
+	expectedAttempts int
+	expectedStatus   int
+}{
+	{testName: "success at first", statuses: []int{200}, expectedAttempts: 1, expectedStatus: 200},
+	{testName: "success after transient errors", statuses: []int{502, 503, 200}, expectedAttempts: 3, expectedStatus: 200},
+	{testName: "gives up after max attempts", statuses: []int{503, 503, 503, 200}, expectedAttempts: 3, expectedStatus: 503},
+	{testName: "client errors are not retried", statuses: []int{400, 200}, expectedAttempts: 1, expectedStatus: 400},
+	{testName: "short retry-after is honored", statuses: []int{429, 200}, retryAfter: "0", expectedAttempts: 2, expectedStatus: 200},
+	{testName: "long retry-after gives up", statuses: []int{429, 200}, retryAfter: "3600", expectedAttempts: 1, expectedStatus: 429},
+}
+
+func TestTools_PushJSONToRemote_Retry(t *testing.T) {
+	for _, e := range retryTests {
+		attempts := 0
+		var bodies []string
+		var keys []string
+
+		client := NewTestClient(func(request *http.Request) *http.Response {
+			body, _ := io.ReadAll(request.Body)
+			bodies = append(bodies, string(body))
+			keys = append(keys, request.Header.Get("Idempotency-Key"))
+
+			status := e.statuses[attempts]
+			attempts++
+
+			header := make(http.Header)
+			if e.retryAfter != "" {
+				header.Set("Retry-After", e.retryAfter)
+			}
+
+			return &http.Response{
+				StatusCode: status,
+				Body:       io.NopCloser(bytes.NewBufferString("ok")),
+				Header:     header,
+			}
+		})
+
+		testTools := Tools{
+			RetryPolicy: &RetryPolicy{
+				MaxAttempts:          3,
+				InitialBackoff:       time.Millisecond,
+				MaxBackoff:           10 * time.Millisecond,
+				IdempotencyKeyHeader: "Idempotency-Key",
+			},
+		}
+
+		_, status, err := testTools.PushJSONToRemote("http://example.com/some/path", map[string]string{"foo": "bar"}, client)
+		if err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.testName, err.Error())
+		}
+
+		if attempts != e.expectedAttempts {
+			t.Errorf("%s: expected %d attempts but got %d", e.testName, e.expectedAttempts, attempts)
+		}
+
+		if status != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.testName, e.expectedStatus, status)
+		}
+
+		for i := range bodies {
+			if bodies[i] != `{"foo":"bar"}` {
+				t.Errorf("%s: wrong body on attempt %d: %s", e.testName, i+1, bodies[i])
+			}
+
+			if keys[i] == "" || keys[i] != keys[0] {
+				t.Errorf("%s: idempotency key must be the same on every attempt, got %v", e.testName, keys)
+			}
+		}
+	}
+}
+
+func TestTools_SendJSON_Retry(t *testing.T) {
+	attempts := 0
+
+	testTools := Tools{
+		RetryPolicy: &RetryPolicy{InitialBackoff: time.Millisecond},
+		HTTPClient: NewTestClient(func(request *http.Request) *http.Response {
+			attempts++
+
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Body:       io.NopCloser(bytes.NewBufferString(`{"error": true, "message": "down"}`)),
+				Header:     make(http.Header),
+			}
+		}),
+	}
+
+	_, err := testTools.PostJSON("http://example.com/some/path", map[string]string{"foo": "bar"}, nil)
+
+	var remoteErr *RemoteError
+	if !errors.As(err, &remoteErr) || remoteErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected RemoteError with 503 but got %v", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("expected the default of 3 attempts but got %d", attempts)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2023, 7, 8, 12, 0, 0, 0, time.UTC)
+
+	d, ok := retryAfter("120", now)
+	if !ok || d != 2*time.Minute {
+		t.Errorf("wrong delay for seconds: %v", d)
+	}
+
+	d, ok = retryAfter("Sat, 08 Jul 2023 12:00:30 GMT", now)
+	if !ok || d != 30*time.Second {
+		t.Errorf("wrong delay for date: %v", d)
+	}
+
+	if _, ok = retryAfter("soon", now); ok {
+		t.Error("garbage should not be parsed")
+	}
+}
@@ -0,0 +1,451 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// the words a slug is made of, depending on what's kept
+	slugWordRe        = regexp.MustCompile(`[a-z\d]+`)
+	slugCaseWordRe    = regexp.MustCompile(`[a-zA-Z\d]+`)
+	slugUnicodeWordRe = regexp.MustCompile(`[\p{L}\p{M}\p{N}]+`)
+
+	// what Tools.Slugify uses when Tools.Slugifier isn't set
+	defaultSlugifier = NewSlugifier(SlugOptions{})
+	unicodeSlugifier = NewSlugifier(SlugOptions{KeepUnicode: true})
+)
+
+// SlugStopWords are common words, by language, that can be left out of slugs
+// with SlugOptions.StopWords, like SlugStopWords["en"]
+var SlugStopWords = map[string][]string{
+	"en": {"a", "an", "and", "as", "at", "by", "for", "from", "in", "into", "is", "of", "on", "or", "the", "to", "with"},
+	"pt": {"a", "as", "à", "às", "com", "da", "das", "de", "do", "dos", "e", "em", "na", "nas", "no", "nos", "o", "os", "ou", "para", "por", "um", "uma"},
+	"es": {"a", "al", "con", "de", "del", "el", "en", "la", "las", "lo", "los", "o", "para", "por", "un", "una", "y"},
+	"fr": {"à", "au", "aux", "de", "des", "du", "en", "et", "la", "le", "les", "ou", "par", "pour", "sur", "un", "une"},
+	"de": {"am", "an", "auf", "das", "dem", "den", "der", "des", "die", "ein", "eine", "im", "in", "mit", "und", "von", "zu", "zum", "zur"},
+}
+
+// SlugOptions configure a Slugifier, the zero value gives
+// the same slugs as Tools.Slugify
+type SlugOptions struct {
+	// goes between words (default "-")
+	Separator string
+	// longest slug in characters, cut on a word boundary (no limit when 0).
+	// A first word longer than that is cut in the middle
+	MaxLength int
+	// keeps uppercase letters instead of lowercasing everything
+	PreserveCase bool
+	// keeps unicode letters instead of transliterating them
+	KeepUnicode bool
+	// words left out of the slug, unless nothing else is left
+	StopWords []string
+	// replaced before anything else, like "&" to "and", the
+	// replacement is kept apart from the words around it
+	Substitutions map[string]string
+}
+
+// Slugifier makes slugs with the same options over and over, everything
+// that can be prepared is prepared once in NewSlugifier. It's safe for
+// concurrent use. The zero value, and nil, work like NewSlugifier(SlugOptions{})
+type Slugifier struct {
+	options   SlugOptions
+	wordRe    *regexp.Regexp
+	stopWords map[string]bool
+	replacer  *strings.Replacer
+}
+
+// NewSlugifier creates a Slugifier with the given options
+func NewSlugifier(options SlugOptions) *Slugifier {
+	if options.Separator == "" {
+		options.Separator = "-"
+	}
+
+	s := &Slugifier{
+		options:   options,
+		wordRe:    slugWordRe,
+		stopWords: make(map[string]bool),
+	}
+
+	if options.KeepUnicode {
+		s.wordRe = slugUnicodeWordRe
+	} else if options.PreserveCase {
+		s.wordRe = slugCaseWordRe
+	}
+
+	// stop words go through the same steps as the words they're compared to
+	for _, word := range options.StopWords {
+		word = strings.ToLower(word)
+		if !options.KeepUnicode {
+			word = transliterate(word)
+		}
+		s.stopWords[word] = true
+	}
+
+	if len(options.Substitutions) > 0 {
+		// longest first, so "&&" wins over "&", and always in the same order
+		keys := make([]string, 0, len(options.Substitutions))
+		for k := range options.Substitutions {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) > len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+
+		var pairs []string
+		for _, k := range keys {
+			pairs = append(pairs, k, " "+options.Substitutions[k]+" ")
+		}
+		s.replacer = strings.NewReplacer(pairs...)
+	}
+
+	return s
+}
+
+// s itself when it came from NewSlugifier, the defaults otherwise
+func (s *Slugifier) prepared() *Slugifier {
+	if s == nil || s.wordRe == nil {
+		return defaultSlugifier
+	}
+
+	return s
+}
+
+// the Slugifier used by Tools.Slugify
+func (t *Tools) slugifier() *Slugifier {
+	switch {
+	case t.Slugifier != nil:
+		return t.Slugifier.prepared()
+	case t.SlugKeepUnicode:
+		return unicodeSlugifier
+	default:
+		return defaultSlugifier
+	}
+}
+
+// Slugify creates a slug from str
+func (s *Slugifier) Slugify(str string) (string, error) {
+	s = s.prepared()
+
+	if str == "" {
+		return "", errors.New("empty string")
+	}
+
+	if s.replacer != nil {
+		str = s.replacer.Replace(str)
+	}
+
+	if !s.options.PreserveCase {
+		str = strings.ToLower(str)
+	}
+
+	if !s.options.KeepUnicode {
+		str = transliterate(str)
+	}
+
+	words := s.wordRe.FindAllString(str, -1)
+
+	if len(s.stopWords) > 0 {
+		var kept []string
+		for _, word := range words {
+			if !s.stopWords[strings.ToLower(word)] {
+				kept = append(kept, word)
+			}
+		}
+
+		// a title made only of stop words still gets a slug
+		if len(kept) > 0 {
+			words = kept
+		}
+	}
+
+	slug := s.join(words)
+	if len(slug) == 0 {
+		return "", errors.New("slug is zero length")
+	}
+
+	return slug, nil
+}
+
+// joins the words, stopping at the last one that fits in MaxLength
+func (s *Slugifier) join(words []string) string {
+	max := s.options.MaxLength
+	sep := s.options.Separator
+
+	if max <= 0 {
+		return strings.Join(words, sep)
+	}
+
+	var b strings.Builder
+	length := 0
+
+	for i, word := range words {
+		wordLength := utf8.RuneCountInString(word)
+
+		if i == 0 {
+			if wordLength > max {
+				return string([]rune(word)[:max])
+			}
+		} else {
+			wordLength += utf8.RuneCountInString(sep)
+			if length+wordLength > max {
+				break
+			}
+			b.WriteString(sep)
+		}
+
+		b.WriteString(word)
+		length += wordLength
+	}
+
+	return b.String()
+}
+
+// slugTransliterations are the letters that don't turn into ascii just by
+// dropping their accents, all lowercase since we lowercase first
+var slugTransliterations = map[rune]string{
+	// german, looked up before the accents are dropped so ä becomes ae and not a
+	'ä': "ae", 'ö': "oe", 'ü': "ue", 'ß': "ss",
+
+	// latin extended
+	'æ': "ae", 'œ': "oe", 'ø': "o", 'å': "aa", 'đ': "d", 'ð': "d", 'þ': "th",
+	'ł': "l", 'ŀ': "l", 'ħ': "h", 'ı': "i", 'ŋ': "ng", 'ŧ': "t", 'ĸ': "k",
+	'ĳ': "ij", 'ǆ': "dz", 'ǳ': "dz", 'ǉ': "lj", 'ǌ': "nj", 'ŉ': "n",
+	'ﬀ': "ff", 'ﬁ': "fi", 'ﬂ': "fl", 'ﬃ': "ffi", 'ﬄ': "ffl", 'ﬅ': "st", 'ﬆ': "st",
+
+	// cyrillic, russian plus the ukrainian, belarusian and serbian letters
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "",
+	'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya", 'і': "i", 'ї': "yi",
+	'є': "ye", 'ґ': "g", 'ў': "u", 'ђ': "dj", 'ј': "j", 'љ': "lj", 'њ': "nj",
+	'ћ': "c", 'џ': "dz", 'ѓ': "g", 'ќ': "k", 'ѕ': "dz",
+
+	// greek, accented vowels lose their accent first and end up here too
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
+
+// slugAccents is the NFKD decomposition of the lowercase latin, greek and
+// cyrillic letters with accents, grouped by the letter left once the
+// accents are dropped. The standard library has no unicode normalization,
+// and this is the part of it slugs need
+var slugAccents = map[rune]string{
+	'a': "àáâãäåāăąǎǟǡǻȁȃȧḁạảấầẩẫậắằẳẵặẚ",
+	'b': "ḃḅḇ",
+	'c': "çćĉċčḉ",
+	'd': "ďḋḍḏḑḓ",
+	'e': "èéêëēĕėęěȅȇȩḕḗḙḛḝẹẻẽếềểễệ",
+	'f': "ḟ",
+	'g': "ĝğġģǧǵḡ",
+	'h': "ĥȟḣḥḧḩḫẖ",
+	'i': "ìíîïĩīĭįǐȉȋḭḯỉị",
+	'j': "ĵǰ",
+	'k': "ķǩḱḳḵ",
+	'l': "ĺļľḷḹḻḽ",
+	'm': "ḿṁṃ",
+	'n': "ñńņňǹṅṇṉṋ",
+	'o': "òóôõöōŏőơǒǫǭȍȏȫȭȯȱṍṏṑṓọỏốồổỗộớờởỡợ",
+	'p': "ṕṗ",
+	'r': "ŕŗřȑȓṙṛṝṟ",
+	's': "śŝşšșṡṣṥṧṩẛ",
+	't': "ţťțṫṭṯṱẗ",
+	'u': "ùúûüũūŭůűųưǔǖǘǚǜȕȗṳṵṷṹṻụủứừửữự",
+	'v': "ṽṿ",
+	'w': "ŵẁẃẅẇẉẘ",
+	'x': "ẋẍ",
+	'y': "ýÿŷȳẏẙỳỵỷỹ",
+	'z': "źżžẑẓẕ",
+	'æ': "ǣǽ",
+	'ø': "ǿ",
+	'α': "άἀἁἂἃἄἅἆἇὰάᾀᾁᾂᾃᾄᾅᾆᾇᾰᾱᾲᾳᾴᾶᾷ",
+	'ε': "έἐἑἒἓἔἕὲέ",
+	'η': "ήἠἡἢἣἤἥἦἧὴήᾐᾑᾒᾓᾔᾕᾖᾗῂῃῄῆῇ",
+	'ι': "ΐίϊἰἱἲἳἴἵἶἷὶίῐῑῒΐῖῗ",
+	'ο': "όὀὁὂὃὄὅὸό",
+	'ρ': "ῤῥ",
+	'υ': "ΰϋύὐὑὒὓὔὕὖὗὺύῠῡῢΰῦῧ",
+	'ω': "ώὠὡὢὣὤὥὦὧὼώᾠᾡᾢᾣᾤᾥᾦᾧῲῳῴῶῷ",
+	'а': "ӑӓ",
+	'е': "ѐӗ",
+	'ж': "ӂӝ",
+	'з': "ӟ",
+	'и': "ѝӣӥ",
+	'о': "ӧ",
+	'у': "ӯӱӳ",
+	'ч': "ӵ",
+	'ы': "ӹ",
+	'э': "ӭ",
+}
+
+// slugBaseLetters is slugAccents the other way around, accented letter to base letter
+var slugBaseLetters = func() map[rune]rune {
+	m := make(map[rune]rune)
+	for base, accented := range slugAccents {
+		for _, r := range accented {
+			m[r] = base
+		}
+	}
+	return m
+}()
+
+// transliterate turns a string into ascii where it knows how: letters in
+// the table are replaced, the others lose their accents and are looked up
+// again, so "crème" becomes "creme" and "ά" becomes "a". Uppercase letters
+// stay uppercase, "Щука" becomes "Shchuka". Full width forms become plain
+// ascii. Scripts we don't know, like japanese, are left as they are for
+// the caller to drop
+func transliterate(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		switch {
+		case r < unicode.MaxASCII:
+			b.WriteRune(r)
+		case r >= '！' && r <= '～':
+			// full width ascii, like "Ｇｏ"
+			b.WriteRune(r - 0xFEE0)
+		case unicode.Is(unicode.Mn, r):
+			// accents already split from their letter
+		case unicode.IsUpper(r):
+			latin := transliterateRune(unicode.ToLower(r))
+			if first, size := utf8.DecodeRuneInString(latin); size > 0 {
+				b.WriteRune(unicode.ToUpper(first))
+				b.WriteString(latin[size:])
+			}
+		default:
+			b.WriteString(transliterateRune(r))
+		}
+	}
+
+	return b.String()
+}
+
+// transliterates a lowercase letter
+func transliterateRune(r rune) string {
+	if latin, ok := slugTransliterations[r]; ok {
+		return latin
+	}
+
+	if base, ok := slugBaseLetters[r]; ok {
+		r = base
+	}
+
+	if latin, ok := slugTransliterations[r]; ok {
+		return latin
+	}
+
+	return string(r)
+}
+
+// ErrNoUniqueSlug is returned by UniqueSlug when every slug it tried was taken
+var ErrNoUniqueSlug = errors.New("no unique slug found")
+
+// SlugStrategy is how UniqueSlug changes a slug that's already taken
+type SlugStrategy int
+
+const (
+	// SlugNumericSuffix counts up: "my-post-2", "my-post-3"...
+	SlugNumericSuffix SlugStrategy = iota
+	// SlugRandomSuffix adds 6 random characters: "my-post-x7k2qa"
+	SlugRandomSuffix
+	// SlugDatePrefix adds today's date, then counts up if that's
+	// taken too: "2023-07-08-my-post", "2023-07-08-my-post-2"...
+	SlugDatePrefix
+)
+
+// characters for random suffixes, fine in any slug
+const slugSuffixAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// UniqueSlug creates a slug from s that exists says is not taken yet, following
+// SlugStrategy. It gives up with ErrNoUniqueSlug after SlugMaxAttempts slugs,
+// and keeps within the Slugifier MaxLength by shortening the slug, never the
+// suffix
+func (t *Tools) UniqueSlug(s string, exists func(slug string) (bool, error)) (string, error) {
+	slugifier := t.slugifier()
+
+	base, err := slugifier.Slugify(s)
+	if err != nil {
+		return "", err
+	}
+
+	attempts := t.SlugMaxAttempts
+	if attempts <= 0 {
+		attempts = 20
+	}
+
+	sep := slugifier.options.Separator
+	date := time.Now().Format("2006-01-02")
+
+	for i := 0; i < attempts; i++ {
+		var prefix, suffix string
+
+		switch t.SlugStrategy {
+		case SlugRandomSuffix:
+			if i > 0 {
+				random, err := randomString(6, slugSuffixAlphabet)
+				if err != nil {
+					return "", err
+				}
+				suffix = sep + random
+			}
+		case SlugDatePrefix:
+			if i > 0 {
+				prefix = date + sep
+			}
+			if i > 1 {
+				suffix = sep + strconv.Itoa(i)
+			}
+		default:
+			if i > 0 {
+				suffix = sep + strconv.Itoa(i+1)
+			}
+		}
+
+		candidate := prefix + slugifier.shorten(base, utf8.RuneCountInString(prefix+suffix)) + suffix
+
+		taken, err := exists(candidate)
+		if err != nil {
+			return "", fmt.Errorf("checking slug %q: %w", candidate, err)
+		}
+
+		if !taken {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w after %d attempts for %q", ErrNoUniqueSlug, attempts, base)
+}
+
+// cuts slug so reserved more characters still fit in MaxLength,
+// without leaving a separator hanging at the end
+func (s *Slugifier) shorten(slug string, reserved int) string {
+	if s.options.MaxLength <= 0 {
+		return slug
+	}
+
+	room := s.options.MaxLength - reserved
+	if room < 1 {
+		room = 1
+	}
+
+	r := []rune(slug)
+	if len(r) <= room {
+		return slug
+	}
+
+	return strings.TrimRight(string(r[:room]), s.options.Separator)
+}
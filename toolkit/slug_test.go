@@ -0,0 +1,201 @@
+package toolkit
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+var unicodeSlugTests = []struct {
+	testName      string
+	s             string
+	keepUnicode   bool
+	expected      string
+	errorExpected bool
+}{
+	{testName: "accents", s: "Café Crème", expected: "cafe-creme"},
+	{testName: "decomposed accents", s: "Cafe\u0301 Cre\u0300me", expected: "cafe-creme"},
+	{testName: "german", s: "Größe Äpfel über Straße", expected: "groesse-aepfel-ueber-strasse"},
+	{testName: "latin extended", s: "Łódź Ærø Þór", expected: "lodz-aero-thor"},
+	{testName: "vietnamese", s: "Tiếng Việt", expected: "tieng-viet"},
+	{testName: "russian", s: "Привет, мир!", expected: "privet-mir"},
+	{testName: "ukrainian", s: "Їжак і єнот", expected: "yizhak-i-yenot"},
+	{testName: "greek", s: "Καλημέρα κόσμε", expected: "kalimera-kosme"},
+	{testName: "full width", s: "Ｇｏ １２３", expected: "go-123"},
+	{testName: "ligature", s: "ﬁnal", expected: "final"},
+	{testName: "japanese still fails", s: "こんにちは", errorExpected: true},
+	{testName: "keep cyrillic", s: "Привет, мир!", keepUnicode: true, expected: "привет-мир"},
+	{testName: "keep accents", s: "Café Crème", keepUnicode: true, expected: "café-crème"},
+	{testName: "keep japanese", s: "こんにちは、ベイビー", keepUnicode: true, expected: "こんにちは-ベイビー"},
+	{testName: "keep only punctuation", s: "!!! ???", keepUnicode: true, errorExpected: true},
+}
+
+func TestTools_SlugifyUnicode(t *testing.T) {
+	for _, e := range unicodeSlugTests {
+		testTools := Tools{SlugKeepUnicode: e.keepUnicode}
+
+		slug, err := testTools.Slugify(e.s)
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected but not received, got %q", e.testName, slug)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", e.testName, err)
+			continue
+		}
+
+		if slug != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.testName, e.expected, slug)
+		}
+	}
+}
+
+var slugifierTests = []struct {
+	testName string
+	options  SlugOptions
+	s        string
+	expected string
+}{
+	{testName: "defaults", options: SlugOptions{}, s: "Hello My Dear!!", expected: "hello-my-dear"},
+	{testName: "separator", options: SlugOptions{Separator: "_"}, s: "Hello My Dear!!", expected: "hello_my_dear"},
+	{testName: "max length on word boundary", options: SlugOptions{MaxLength: 12}, s: "Now is the time for all good men", expected: "now-is-the"},
+	{testName: "max length exact", options: SlugOptions{MaxLength: 13}, s: "hello my dear", expected: "hello-my-dear"},
+	{testName: "max length long first word", options: SlugOptions{MaxLength: 5}, s: "Supercalifragilistic words", expected: "super"},
+	{testName: "max length unicode", options: SlugOptions{MaxLength: 6, KeepUnicode: true}, s: "Привет мир", expected: "привет"},
+	{testName: "preserve case", options: SlugOptions{PreserveCase: true}, s: "Hello Go World", expected: "Hello-Go-World"},
+	{testName: "preserve case transliterated", options: SlugOptions{PreserveCase: true}, s: "Щука Ärger", expected: "Shchuka-Aerger"},
+	{testName: "stop words", options: SlugOptions{StopWords: SlugStopWords["en"]}, s: "The Lord of the Rings", expected: "lord-rings"},
+	{testName: "stop words with accents", options: SlugOptions{StopWords: SlugStopWords["pt"]}, s: "Viagem à praia com a família", expected: "viagem-praia-familia"},
+	{testName: "only stop words", options: SlugOptions{StopWords: SlugStopWords["en"]}, s: "The The", expected: "the-the"},
+	{testName: "substitutions", options: SlugOptions{Substitutions: map[string]string{"&": "and", "@": "at"}}, s: "Fish&Chips @ home", expected: "fish-and-chips-at-home"},
+	{testName: "longest substitution first", options: SlugOptions{Substitutions: map[string]string{"&": "and", "&&": "both"}}, s: "a && b", expected: "a-both-b"},
+	{testName: "everything", options: SlugOptions{Separator: "_", MaxLength: 20, StopWords: SlugStopWords["en"], Substitutions: map[string]string{"&": "plus"}}, s: "The Cat & the Hat in the House", expected: "cat_plus_hat_house"},
+}
+
+func TestSlugifier_Slugify(t *testing.T) {
+	for _, e := range slugifierTests {
+		slugifier := NewSlugifier(e.options)
+
+		slug, err := slugifier.Slugify(e.s)
+		if err != nil {
+			t.Errorf("%s: %v", e.testName, err)
+			continue
+		}
+
+		if slug != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.testName, e.expected, slug)
+		}
+	}
+
+	if _, err := NewSlugifier(SlugOptions{}).Slugify(""); err == nil {
+		t.Error("empty string should fail")
+	}
+}
+
+func TestTools_Slugifier(t *testing.T) {
+	testTools := Tools{Slugifier: NewSlugifier(SlugOptions{Separator: "."})}
+
+	slug, err := testTools.Slugify("Hello World")
+	if err != nil || slug != "hello.world" {
+		t.Errorf("Slugify should use the Slugifier, got %s (%v)", slug, err)
+	}
+}
+
+func BenchmarkTools_Slugify(b *testing.B) {
+	var testTools Tools
+
+	for i := 0; i < b.N; i++ {
+		_, _ = testTools.Slugify("Now is the time for all GOOD men! - Café Crème & such")
+	}
+}
+
+// an exists func backed by a set of taken slugs, counting the calls
+func takenSlugs(taken ...string) (func(string) (bool, error), *[]string) {
+	set := make(map[string]bool)
+	for _, s := range taken {
+		set[s] = true
+	}
+
+	var checked []string
+	return func(slug string) (bool, error) {
+		checked = append(checked, slug)
+		return set[slug], nil
+	}, &checked
+}
+
+var uniqueSlugTests = []struct {
+	testName      string
+	tools         Tools
+	taken         []string
+	pattern       string
+	errorExpected bool
+}{
+	{testName: "free", taken: nil, pattern: `^hello-world$`},
+	{testName: "numeric", taken: []string{"hello-world", "hello-world-2"}, pattern: `^hello-world-3$`},
+	{testName: "random", tools: Tools{SlugStrategy: SlugRandomSuffix}, taken: []string{"hello-world"}, pattern: `^hello-world-[a-z0-9]{6}$`},
+	{testName: "date", tools: Tools{SlugStrategy: SlugDatePrefix}, taken: []string{"hello-world"}, pattern: `^\d{4}-\d{2}-\d{2}-hello-world$`},
+	{testName: "separator", tools: Tools{Slugifier: NewSlugifier(SlugOptions{Separator: "_"})}, taken: []string{"hello_world"}, pattern: `^hello_world_2$`},
+	{testName: "max length", tools: Tools{Slugifier: NewSlugifier(SlugOptions{MaxLength: 11})}, taken: []string{"hello-world"}, pattern: `^hello-wor-2$`},
+	{testName: "max length already short", tools: Tools{Slugifier: NewSlugifier(SlugOptions{MaxLength: 8})}, taken: []string{"hello"}, pattern: `^hello-2$`},
+	{testName: "attempts", tools: Tools{SlugMaxAttempts: 2}, taken: []string{"hello-world", "hello-world-2"}, errorExpected: true},
+}
+
+func TestTools_UniqueSlug(t *testing.T) {
+	for _, e := range uniqueSlugTests {
+		exists, checked := takenSlugs(e.taken...)
+
+		slug, err := e.tools.UniqueSlug("Hello World", exists)
+		if e.errorExpected {
+			if !errors.Is(err, ErrNoUniqueSlug) {
+				t.Errorf("%s: expected ErrNoUniqueSlug but got %v", e.testName, err)
+			}
+			if len(*checked) != e.tools.SlugMaxAttempts {
+				t.Errorf("%s: expected %d checks but got %d", e.testName, e.tools.SlugMaxAttempts, len(*checked))
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", e.testName, err)
+			continue
+		}
+
+		if !regexp.MustCompile(e.pattern).MatchString(slug) {
+			t.Errorf("%s: %s does not match %s", e.testName, slug, e.pattern)
+		}
+
+		if max := e.tools.slugifier().options.MaxLength; max > 0 && len(slug) > max {
+			t.Errorf("%s: %s is longer than %d", e.testName, slug, max)
+		}
+	}
+}
+
+func TestTools_UniqueSlugExistsError(t *testing.T) {
+	var testTools Tools
+
+	dbErr := errors.New("connection refused")
+
+	_, err := testTools.UniqueSlug("Hello", func(string) (bool, error) { return false, dbErr })
+	if !errors.Is(err, dbErr) {
+		t.Errorf("expected the exists error but got %v", err)
+	}
+}
+
+func TestSlugifier_ZeroValue(t *testing.T) {
+	var nilSlugifier *Slugifier
+
+	for _, s := range []*Slugifier{{}, nilSlugifier} {
+		slug, err := s.Slugify("Hello World")
+		if err != nil || slug != "hello-world" {
+			t.Errorf("expected hello-world but got %q (%v)", slug, err)
+		}
+	}
+
+	testTools := Tools{Slugifier: &Slugifier{}}
+	if slug, err := testTools.Slugify("Hello World"); err != nil || slug != "hello-world" {
+		t.Errorf("expected hello-world but got %q (%v)", slug, err)
+	}
+}
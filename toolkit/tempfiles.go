@@ -0,0 +1,155 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the temp root, created on first use
+func (t *Tools) tempRoot() (string, error) {
+	root := t.TempRoot
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "toolkit")
+	}
+
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return "", err
+	}
+
+	// in a shared place like /tmp somebody else could have made it first,
+	// as a symlink to somewhere else or readable by everyone
+	info, err := os.Lstat(root)
+	if err != nil {
+		return "", err
+	}
+
+	if !info.IsDir() {
+		return "", fmt.Errorf("temp root %s is not a directory", root)
+	}
+
+	if info.Mode().Perm()&0077 != 0 {
+		if err := os.Chmod(root, 0700); err != nil {
+			return "", err
+		}
+	}
+
+	return root, nil
+}
+
+// temp names start with the pid of the process that made them, so
+// SweepTempRoot knows what's ours
+func tempPattern(pattern string) string {
+	return strconv.Itoa(os.Getpid()) + "-" + filepath.Base(pattern)
+}
+
+// removes path once ctx is done, if it ever is
+func removeWhenDone(ctx context.Context, path string, cleanup func()) {
+	if ctx.Done() == nil {
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		cleanup()
+		_ = os.RemoveAll(path)
+	}()
+}
+
+// TempFile creates a file in TempRoot, readable only by us, named after
+// pattern like os.CreateTemp does ("upload-*.png"). It's closed and
+// removed when ctx is done, for a request's context that's when the
+// handler returns. With a context that's never done, like
+// context.Background(), removing it is up to you
+func (t *Tools) TempFile(ctx context.Context, pattern string) (*os.File, error) {
+	root, err := t.tempRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	// os.CreateTemp already makes it 0600
+	f, err := os.CreateTemp(root, tempPattern(pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	removeWhenDone(ctx, f.Name(), func() { _ = f.Close() })
+
+	return f, nil
+}
+
+// TempDir creates a directory in TempRoot, usable only by us, named after
+// pattern like os.MkdirTemp does. It's removed with everything in it when
+// ctx is done, like TempFile
+func (t *Tools) TempDir(ctx context.Context, pattern string) (string, error) {
+	root, err := t.tempRoot()
+	if err != nil {
+		return "", err
+	}
+
+	// os.MkdirTemp already makes it 0700
+	dir, err := os.MkdirTemp(root, tempPattern(pattern))
+	if err != nil {
+		return "", err
+	}
+
+	removeWhenDone(ctx, dir, func() {})
+
+	return dir, nil
+}
+
+// SweepTempRoot removes what other processes left in TempRoot, usually
+// because they crashed before cleaning up, and returns the removed
+// names. It's meant to run at startup. Only entries not modified for
+// olderThan are removed, so if several processes share TempRoot pick
+// something longer than any of them keeps a temp file around
+func (t *Tools) SweepTempRoot(olderThan time.Duration) ([]string, error) {
+	root, err := t.tempRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	ours := strconv.Itoa(os.Getpid()) + "-"
+	cutoff := time.Now().Add(-olderThan)
+
+	removed := []string{}
+	var errs []error
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ours) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if info.ModTime().After(cutoff) {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		removed = append(removed, entry.Name())
+	}
+
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,123 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_TempFile(t *testing.T) {
+	testTools := Tools{TempRoot: filepath.Join(t.TempDir(), "scratch")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	f, err := testTools.TempFile(ctx, "upload-*.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.WriteString("hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Base(f.Name())
+	if !strings.HasPrefix(name, strconv.Itoa(os.Getpid())+"-upload-") || !strings.HasSuffix(name, ".png") {
+		t.Errorf("wrong temp file name: %s", name)
+	}
+
+	info, _ := os.Stat(f.Name())
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected 0600 but got %v", info.Mode().Perm())
+	}
+
+	root, _ := os.Stat(testTools.TempRoot)
+	if root.Mode().Perm() != 0700 {
+		t.Errorf("expected the root to be 0700 but got %v", root.Mode().Perm())
+	}
+
+	cancel()
+
+	eventually(t, "the temp file removed", func() bool {
+		_, err := os.Stat(f.Name())
+		return errors.Is(err, fs.ErrNotExist)
+	})
+}
+
+func TestTools_TempDirRequest(t *testing.T) {
+	testTools := Tools{TempRoot: t.TempDir()}
+
+	var dir string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		dir, err = testTools.TempDir(r.Context(), "work-*")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		_ = os.WriteFile(filepath.Join(dir, "scratch.txt"), []byte("hello"), 0600)
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// the request is over, everything goes
+	eventually(t, "the temp dir removed", func() bool {
+		_, err := os.Stat(dir)
+		return errors.Is(err, fs.ErrNotExist)
+	})
+}
+
+func TestTools_SweepTempRoot(t *testing.T) {
+	testTools := Tools{TempRoot: t.TempDir()}
+
+	// ours, kept even when old
+	ours, err := testTools.TempFile(context.Background(), "mine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours.Close()
+
+	// left behind by crashed processes
+	old := time.Now().Add(-2 * time.Hour)
+	crashedFile := filepath.Join(testTools.TempRoot, "999999999-upload-123")
+	crashedDir := filepath.Join(testTools.TempRoot, "999999999-work-456")
+	recent := filepath.Join(testTools.TempRoot, "999999998-upload-789")
+
+	_ = os.WriteFile(crashedFile, []byte("x"), 0600)
+	_ = os.MkdirAll(filepath.Join(crashedDir, "sub"), 0700)
+	_ = os.WriteFile(recent, []byte("x"), 0600)
+
+	for _, name := range []string{ours.Name(), crashedFile, crashedDir} {
+		_ = os.Chtimes(name, old, old)
+	}
+
+	removed, err := testTools.SweepTempRoot(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(removed, ",") != "999999999-upload-123,999999999-work-456" {
+		t.Errorf("wrong entries removed: %v", removed)
+	}
+
+	for _, name := range []string{ours.Name(), recent} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("%s should be kept", name)
+		}
+	}
+}
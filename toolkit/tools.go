@@ -2,18 +2,22 @@ package toolkit
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"io"
+	"io/fs"
+	"log/slog"
+	"math/bits"
 	"mime/multipart"
 	"net/http"
-	"os"
 	"path"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"time"
 )
 
 const randomStringSource = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_+"
@@ -23,54 +27,134 @@ type Tools struct {
 	AllowedFileTypes       []string
 	MaxJSONSize            int
 	AllowJSONUnknownFields bool
+	// limits used by ReadJSONStream, the first one is
+	// applied to each item and the second to the whole body
+	MaxJSONItemSize   int
+	MaxJSONStreamSize int
+	// encodings used to compress responses and decompress
+	// requests, gzip and deflate are used when empty
+	ContentEncoders []ContentEncoder
+	CompressMinSize int
+	// when set ReadJSON answers anything that isn't
+	// application/json (or +json) with a 415
+	RequireJSONContentType bool
+	TranscodeJSONCharset   bool
+	// per_page used by ReadPagination when the client
+	// doesn't send one, and the most it may ask for
+	DefaultPerPage int
+	MaxPerPage     int
+	// the highest page ReadPagination accepts (default 100000)
+	MaxPage int
+	// client used for outbound calls like SendJSON, a
+	// default one is used when not set
+	HTTPClient            *http.Client
+	MaxRemoteResponseSize int
+	// retries outbound calls on transient failures, nil means no retries
+	RetryPolicy *RetryPolicy
+	// deadline for a whole outbound call, retries included (default 30s)
+	RemoteTimeout time.Duration
+	// fails outbound calls fast when their host keeps failing
+	CircuitBreaker *CircuitBreaker
+	// checks signatures of incoming webhooks, see VerifyWebhook
+	WebhookVerifier *WebhookVerifier
+	// characters used by RandomString, like AlphabetURLSafe,
+	// randomStringSource is used when empty. Upload names and
+	// internal ids are always letters and digits
+	RandomAlphabet string
+	// how UploadFiles names renamed files, a random string by default
+	UploadFileNameFormat FileNameFormat
+	// filesystem for UploadFiles and the directory helpers, the real one when nil
+	FS FileSystem
+	// renders ServeDirectory listings for browsers, it gets a DirectoryPage
+	DirectoryTemplate *template.Template
+	// where TempFile and TempDir create things, always on disk
+	// (default "toolkit" in the system temp directory)
+	TempRoot string
+	// used by Recoverer and AccessLog, slog.Default() when nil
+	Logger *slog.Logger
+	// proxies RealIP takes the forwarded headers from, as ips or cidrs like "10.0.0.0/8"
+	TrustedProxies []string
+	// keeps unicode letters in slugs instead of transliterating them
+	SlugKeepUnicode bool
+	// used by Slugify when set, for separators, max length and the like
+	Slugifier *Slugifier
+	// how UniqueSlug tells apart a taken slug, a numeric suffix by default
+	SlugStrategy SlugStrategy
+	// slugs UniqueSlug checks before giving up, the plain one included (default 20)
+	SlugMaxAttempts int
 }
 
+// RandomString returns a random string of length characters taken from
+// RandomAlphabet, or randomStringSource when it's empty. It panics if the
+// system random generator fails, which shouldn't ever happen, use
+// GenerateRandomString to get the error instead
 func (t *Tools) RandomString(length int) string {
-	// rune is alias for int32
-	s := make([]rune, length)
-	// this code is converting these strings to their ASCII codes
-	// since we're not trespassing 127, we're safe to use byte or int
-	// but if we'd had emojis or other special characters, rune would've made
-	// all the difference
-	r := []rune(randomStringSource)
-	// output: [97 98 99 100 101 102 103 104 105 106 107 108 109 110 111... etc]
-
-	for i := range s {
-		// now crazy shit starts, get ready...
-		// This function generates a prime number containing 2ˆlen(r-1)+1 to 2ˆlen(r)-1 bits
-		// considering our 64 characters long it's like:
-		// 9.2 quintillions to 18 quintillions bits
-		// remember that it generates a prime number?
-		// to validate it, the code performs a primality test
-		// one very known and used one is Miller-Rabin test
-		// that iterates the generated number like 20 times
-		// before returning the number for us
-		// All of that to generated a 99.9% random number
-		p, _ := rand.Prime(rand.Reader, len(r))
-
-		// this part is just converting it to int64
-		// so we can work with it properly :D
-		x := p.Uint64()
-
-		// this one is doing the same
-		// converting so we can work better
-		y := uint64(len(r))
-
-		// And here we're taking the rest of
-		// the division of 9.who_fucking_cares quintillions by 64
-		// And this number can never be greater than 63
-		// due to Modular Arithmetic:
-		// 100 = 1 x 64 + 36
-		// 200 = 3 x 64 + 8
-		// 300 = 4 x 64 + 52
-		// And it's not limited by 64
-		// any positive number(x) / any positive number(y)
-		// can never have a rest greater than dividend(y) - 1
-		s[i] = r[x%y]
+	s, err := t.GenerateRandomString(length)
+	if err != nil {
+		panic(err)
 	}
 
-	// finally we're converting all that rune array(bits of characters) into string
-	return string(s)
+	return s
+}
+
+// GenerateRandomString is RandomString returning the error from crypto/rand
+func (t *Tools) GenerateRandomString(length int) (string, error) {
+	alphabet := randomStringSource
+	if t.RandomAlphabet != "" {
+		alphabet = t.RandomAlphabet
+	}
+
+	return randomString(length, alphabet)
+}
+
+// where random bytes come from, swapped in tests
+var randomReader io.Reader = rand.Reader
+
+func randomString(length int, alphabet string) (string, error) {
+	// rune is alias for int32, using runes instead of bytes
+	// lets the alphabet have any unicode character
+	r := []rune(alphabet)
+
+	if length < 0 {
+		return "", errors.New("random string length must not be negative")
+	}
+
+	// each random byte picks one character, so 256 is the most we can pick from
+	if len(r) == 0 || len(r) > 256 {
+		return "", errors.New("random string alphabet must have between 1 and 256 characters")
+	}
+
+	// doing byte % len(r) would make the first characters more likely
+	// whenever 256 isn't a multiple of len(r). Instead we keep only the
+	// bits needed to index the alphabet (6 bits for our 64 characters)
+	// and throw away anything that falls out of it, so every
+	// character has exactly the same chance
+	mask := 1<<bits.Len(uint(len(r)-1)) - 1
+
+	s := make([]rune, 0, length)
+
+	// a bit more than length, since some bytes get thrown away
+	buf := make([]byte, length+length/2+8)
+
+	for len(s) < length {
+		if _, err := io.ReadFull(randomReader, buf); err != nil {
+			return "", fmt.Errorf("failed to read random bytes: %w", err)
+		}
+
+		for _, b := range buf {
+			i := int(b) & mask
+			if i >= len(r) {
+				continue
+			}
+
+			s = append(s, r[i])
+			if len(s) == length {
+				break
+			}
+		}
+	}
+
+	return string(s), nil
 }
 
 type UploadFile struct {
@@ -169,25 +253,32 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDirectory string, rename ...b
 				}
 
 				if renameFile {
-					uploadedFile.NewFileName = fmt.Sprintf("%s%s", t.RandomString(10), filepath.Ext(hdr.Filename))
+					randomName, err := t.newFileName()
+					if err != nil {
+						return nil, err
+					}
+					uploadedFile.NewFileName = fmt.Sprintf("%s%s", randomName, filepath.Ext(hdr.Filename))
 				} else {
 					uploadedFile.NewFileName = hdr.Filename
 				}
 
 				uploadedFile.OriginalFileName = hdr.Filename
 
-				var outfile *os.File
+				outfile, err := t.fs().Create(filepath.Join(uploadDirectory, uploadedFile.NewFileName))
+				if err != nil {
+					return nil, err
+				}
 				defer outfile.Close()
 
-				if outfile, err = os.Create(filepath.Join(uploadDirectory, uploadedFile.NewFileName)); err != nil {
+				fileSize, err := io.Copy(outfile, infile)
+				if err != nil {
 					return nil, err
-				} else {
-					fileSize, err := io.Copy(outfile, infile)
-					if err != nil {
-						return nil, err
-					}
+				}
+
+				uploadedFile.FileSize = fileSize
 
-					uploadedFile.FileSize = fileSize
+				if err := outfile.Close(); err != nil {
+					return nil, err
 				}
 
 				uploadedFiles = append(uploadedFiles, &uploadedFile)
@@ -203,42 +294,12 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDirectory string, rename ...b
 	return uploadedFiles, nil
 }
 
-// Creates a directory if not exists
-// and all necessary parents
-func (t *Tools) CreateDirIfNotExists(path string) (err error) {
-	// permission
-	const mode = 0755
-
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err = os.MkdirAll(path, mode)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-// Create slug from string
-// using regex [ˆa-z\d]+
+// Create slug from string, letters from other scripts and with accents
+// are transliterated, so "Café Crème" becomes "cafe-creme". With
+// SlugKeepUnicode letters are kept as they are instead, and with
+// Slugifier set its options are used
 func (t *Tools) Slugify(s string) (slug string, err error) {
-	if s == "" {
-		return "", errors.New("empty string")
-	}
-
-	var re = regexp.MustCompile(`[^a-z\d]+`)
-
-	slug = strings.Trim(
-		re.ReplaceAllString(
-			strings.ToLower(s), "-",
-		), "-",
-	)
-
-	if len(slug) == 0 {
-		return "", errors.New("slug is zero length")
-	}
-
-	return slug, nil
+	return t.slugifier().Slugify(s)
 }
 
 // Downloads a file, forcing browser to avoid displaying it in windows using Content-Disposition
@@ -267,6 +328,18 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 	// limiting request payload
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
+	// gzip and friends are unpacked here, the limit
+	// above is applied again to the decompressed body
+	err = t.decompressBody(w, r, maxBytes)
+	if err != nil {
+		return err
+	}
+
+	err = t.checkJSONContentType(r)
+	if err != nil {
+		return err
+	}
+
 	dec := json.NewDecoder(r.Body)
 
 	if !t.AllowJSONUnknownFields {
@@ -275,47 +348,53 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 
 	err = dec.Decode(data)
 	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		var invalidUnmarshalError *json.InvalidUnmarshalError
+		return jsonDecodeError(err, maxBytes)
+	}
 
-		switch {
-		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+	err = dec.Decode(&struct{}{})
+	if err != io.EOF {
+		return errors.New("body must contain only one json value")
+	}
 
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON")
+	return nil
+}
 
-		case errors.As(err, &unmarshalTypeError):
-			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
-			}
-			return fmt.Errorf("body contains incorrect JSOn type (at character %d)", unmarshalTypeError.Offset)
+// translates the decoder errors into something
+// friendlier to send back to whoever called us
+func jsonDecodeError(err error, maxBytes int) error {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var invalidUnmarshalError *json.InvalidUnmarshalError
 
-		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
+	switch {
+	case errors.As(err, &syntaxError):
+		return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
 
-		case strings.HasPrefix(err.Error(), "json: unknown field"):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("body contains badly-formed JSON")
 
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+	case errors.As(err, &unmarshalTypeError):
+		if unmarshalTypeError.Field != "" {
+			return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		}
+		return fmt.Errorf("body contains incorrect JSOn type (at character %d)", unmarshalTypeError.Offset)
 
-		case errors.As(err, &invalidUnmarshalError):
-			return fmt.Errorf("error unmarshalling JSON: %s", err.Error())
+	case errors.Is(err, io.EOF):
+		return errors.New("body must not be empty")
 
-		default:
-			return err
-		}
-	}
+	case strings.HasPrefix(err.Error(), "json: unknown field"):
+		fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
+		return fmt.Errorf("body contains unknown key %s", fieldName)
 
-	err = dec.Decode(&struct{}{})
-	if err != io.EOF {
-		return errors.New("body must contain only one json value")
-	}
+	case err.Error() == "http: request body too large":
+		return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
 
-	return nil
+	case errors.As(err, &invalidUnmarshalError):
+		return fmt.Errorf("error unmarshalling JSON: %s", err.Error())
+
+	default:
+		return err
+	}
 }
 
 // WriteJSON Response
@@ -343,7 +422,7 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, h
 }
 
 func (t *Tools) ErrorJSONResponse(w http.ResponseWriter, err error, status ...int) error {
-	statusCode := http.StatusBadRequest
+	statusCode := errorStatus(err)
 	if len(status) > 0 {
 		statusCode = status[0]
 	}
@@ -356,25 +435,78 @@ func (t *Tools) ErrorJSONResponse(w http.ResponseWriter, err error, status ...in
 	return t.WriteJSON(w, statusCode, payload)
 }
 
+// the status code that fits the errors returned by the toolkit,
+// anything we don't know about is a bad request
+func errorStatus(err error) int {
+	var mediaTypeError *UnsupportedMediaTypeError
+	var encodingError *UnsupportedEncodingError
+	var methodError *MethodNotAllowedError
+
+	switch {
+	case errors.As(err, &mediaTypeError), errors.As(err, &encodingError):
+		return http.StatusUnsupportedMediaType
+
+	case errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+
+	case errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrWebhookExpired), errors.Is(err, ErrWebhookReplayed):
+		return http.StatusUnauthorized
+
+	case errors.As(err, &methodError):
+		return http.StatusMethodNotAllowed
+
+	case errors.Is(err, ErrOutsideRoot):
+		return http.StatusForbidden
+
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// PushJSONToRemote posts data as JSON to uri. The response body is
+// already closed when it gets back to you, so use SendJSON if you
+// need to read what the remote answered
 func (t *Tools) PushJSONToRemote(uri string, data interface{}, client ...*http.Client) (*http.Response, int, error) {
+	var opts []RequestOption
+	if len(client) > 0 {
+		opts = append(opts, WithClient(client[0]))
+	}
+
+	return t.PushJSONToRemoteContext(context.Background(), uri, data, opts...)
+}
+
+// PushJSONToRemoteContext is PushJSONToRemote bound to ctx, so the call is
+// dropped when ctx is done. Inside a handler pass r.Context(), then a client
+// going away cancels the outbound call too. RemoteTimeout (default 30s)
+// is applied on top of ctx. opts add headers, auth and signatures
+func (t *Tools) PushJSONToRemoteContext(ctx context.Context, uri string, data interface{}, opts ...RequestOption) (*http.Response, int, error) {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	httpClient := &http.Client{}
-	if len(client) > 0 {
-		httpClient = client[0]
-	}
+	ctx, cancel := t.remoteContext(ctx)
+	defer cancel()
 
-	request, err := http.NewRequest("POST", uri, bytes.NewBuffer(jsonData))
+	request, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, 0, err
 	}
 
 	request.Header.Set("Content-Type", "application/json")
 
-	response, err := httpClient.Do(request)
+	httpClient, err := t.applyRequestOptions(request, jsonData, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response, err := t.do(httpClient, request)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -2,6 +2,7 @@ package toolkit
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -59,14 +62,121 @@ func TestTools_RandomString(t *testing.T) {
 	}
 }
 
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("no entropy today")
+}
+
+func TestTools_GenerateRandomString(t *testing.T) {
+	var testTools Tools
+
+	for _, length := range []int{0, 1, 10, 100} {
+		s, err := testTools.GenerateRandomString(length)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if len(s) != length {
+			t.Errorf("wrong random string length returned, expected %d but got %d", length, len(s))
+		}
+
+		for _, c := range s {
+			if !strings.ContainsRune(randomStringSource, c) {
+				t.Errorf("character %q is not in the source", c)
+			}
+		}
+	}
+
+	if _, err := testTools.GenerateRandomString(-1); err == nil {
+		t.Error("negative length should fail")
+	}
+
+	// a broken random source must surface as an error, not as a weak string
+	randomReader = failingReader{}
+	defer func() { randomReader = rand.Reader }()
+
+	if _, err := testTools.GenerateRandomString(10); err == nil {
+		t.Error("expected an error from a failing random source")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RandomString should panic when the random source fails")
+		}
+	}()
+	testTools.RandomString(10)
+}
+
+func TestTools_RandomString_Distribution(t *testing.T) {
+	var testTools Tools
+
+	// with a uniform generator every character shows up about the same number
+	// of times, the chi-squared statistic tells how far we are from that
+	const perCharacter = 2000
+	n := len(randomStringSource) * perCharacter
+
+	s, err := testTools.GenerateRandomString(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[rune]int)
+	for _, c := range s {
+		counts[c]++
+	}
+
+	if len(counts) != len(randomStringSource) {
+		t.Fatalf("expected all %d characters to show up, got %d", len(randomStringSource), len(counts))
+	}
+
+	chiSquared := 0.0
+	for _, count := range counts {
+		diff := float64(count - perCharacter)
+		chiSquared += diff * diff / perCharacter
+	}
+
+	// 63 degrees of freedom, 124.8 is the critical value for p = 0.00001,
+	// so a fair generator fails this about once in a hundred thousand runs
+	if chiSquared > 124.8 {
+		t.Errorf("characters are not uniformly distributed, chi-squared = %.2f", chiSquared)
+	}
+
+	// the old implementation took primes % 64, and since primes are odd,
+	// characters at even positions like 'a' could never be picked
+	if counts['a'] == 0 || counts['_'] == 0 {
+		t.Error("every character must be reachable")
+	}
+}
+
+func BenchmarkTools_RandomString(b *testing.B) {
+	var testTools Tools
+
+	for i := 0; i < b.N; i++ {
+		testTools.RandomString(10)
+	}
+}
+
+func BenchmarkTools_RandomString_Long(b *testing.B) {
+	var testTools Tools
+
+	for i := 0; i < b.N; i++ {
+		testTools.RandomString(1024)
+	}
+}
+
 var uploadTests = []struct {
 	testName      string
 	allowedTypes  []string
 	renameFile    bool
+	nameFormat    FileNameFormat
+	namePattern   string
 	errorExpected bool
 }{
 	{testName: "allowed no rename", allowedTypes: []string{"image/jpeg", "image/png"}, renameFile: false, errorExpected: false},
-	{testName: "allowed rename", allowedTypes: []string{"image/jpeg", "image/png"}, renameFile: true, errorExpected: false},
+	{testName: "allowed rename", allowedTypes: []string{"image/jpeg", "image/png"}, renameFile: true, namePattern: `^[a-zA-Z0-9_+]{10}\.png$`, errorExpected: false},
+	{testName: "rename to uuid v7", allowedTypes: []string{"image/png"}, renameFile: true, nameFormat: FileNameUUIDv7, namePattern: `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}\.png$`, errorExpected: false},
+	{testName: "rename to ulid", allowedTypes: []string{"image/png"}, renameFile: true, nameFormat: FileNameULID, namePattern: `^[0-7][0-9A-HJKMNP-TV-Z]{25}\.png$`, errorExpected: false},
 	{testName: "not allowed file type", allowedTypes: []string{"image/jpeg"}, renameFile: false, errorExpected: true},
 }
 
@@ -137,6 +247,7 @@ func TestTools_UploadFiles(t *testing.T) {
 
 		var testTools Tools
 		testTools.AllowedFileTypes = e.allowedTypes
+		testTools.UploadFileNameFormat = e.nameFormat
 
 		uploadedFiles, err := testTools.UploadFiles(request, "./testdata/uploads/", e.renameFile)
 		if err != nil && !e.errorExpected {
@@ -144,6 +255,10 @@ func TestTools_UploadFiles(t *testing.T) {
 		}
 
 		if !e.errorExpected {
+			if e.namePattern != "" && !regexp.MustCompile(e.namePattern).MatchString(uploadedFiles[0].NewFileName) {
+				t.Errorf("%s: wrong file name %s", e.testName, uploadedFiles[0].NewFileName)
+			}
+
 			// os.Stat returns some information about the file in question
 			// if it does not exists we get an error return, since this only
 			// runs after our writing, it's a great way to check if our
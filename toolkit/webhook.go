@@ -0,0 +1,230 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidSignature means the webhook signature is missing or doesn't match the body
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrWebhookExpired means the webhook timestamp is missing or outside the tolerance
+	ErrWebhookExpired = errors.New("webhook timestamp outside the tolerance")
+	// ErrWebhookReplayed means the same webhook was already received
+	ErrWebhookReplayed = errors.New("webhook already received")
+)
+
+// NonceCache remembers the webhooks already received. Seen records nonce
+// for ttl and tells if it was already there. It's an interface so
+// something shared like redis can be used when running many instances
+type NonceCache interface {
+	Seen(nonce string, ttl time.Duration) bool
+}
+
+// MemoryNonceCache is an in memory NonceCache, the zero value is ready to use
+type MemoryNonceCache struct {
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	calls int
+}
+
+func (c *MemoryNonceCache) Seen(nonce string, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if c.seen == nil {
+		c.seen = make(map[string]time.Time)
+	}
+
+	// every now and then drop what already expired,
+	// so the map doesn't grow forever
+	c.calls++
+	if c.calls%1000 == 0 {
+		for k, exp := range c.seen {
+			if now.After(exp) {
+				delete(c.seen, k)
+			}
+		}
+	}
+
+	if exp, ok := c.seen[nonce]; ok && now.Before(exp) {
+		return true
+	}
+
+	c.seen[nonce] = now.Add(ttl)
+
+	return false
+}
+
+// WebhookVerifier checks webhooks signed like HMACSigner does:
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))
+type WebhookVerifier struct {
+	Secret []byte
+	// default X-Signature
+	SignatureHeader string
+	// default X-Timestamp
+	TimestampHeader string
+	// how far the timestamp may be from now, in both directions (default 5 minutes)
+	Tolerance time.Duration
+	// header with a unique id for each webhook. The signature, which changes
+	// with every timestamp, is always remembered, the nonce is remembered on
+	// top of it to catch the same webhook sent again with a new timestamp.
+	// It isn't signed, so it can't replace the signature
+	NonceHeader string
+	// where received nonces are kept, a MemoryNonceCache when nil
+	Nonces NonceCache
+
+	once sync.Once
+	// swapped in tests
+	now func() time.Time
+}
+
+func (v *WebhookVerifier) tolerance() time.Duration {
+	if v.Tolerance > 0 {
+		return v.Tolerance
+	}
+
+	return 5 * time.Minute
+}
+
+func (v *WebhookVerifier) nonces() NonceCache {
+	v.once.Do(func() {
+		if v.Nonces == nil {
+			v.Nonces = &MemoryNonceCache{}
+		}
+	})
+
+	return v.Nonces
+}
+
+// Verify checks the signature, timestamp and nonce of a webhook with the given raw body
+func (v *WebhookVerifier) Verify(header http.Header, body []byte) error {
+	signatureHeader := v.SignatureHeader
+	if signatureHeader == "" {
+		signatureHeader = "X-Signature"
+	}
+
+	timestampHeader := v.TimestampHeader
+	if timestampHeader == "" {
+		timestampHeader = "X-Timestamp"
+	}
+
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+
+	timestamp := header.Get(timestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrWebhookExpired
+	}
+
+	sentAt := time.Unix(unix, 0)
+	if sentAt.Before(now.Add(-v.tolerance())) || sentAt.After(now.Add(v.tolerance())) {
+		return ErrWebhookExpired
+	}
+
+	signature := header.Get(signatureHeader)
+	given, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || len(given) == 0 {
+		return ErrInvalidSignature
+	}
+
+	// hmac.Equal takes the same time no matter where the
+	// bytes differ, so the signature can't be guessed byte by byte
+	if !hmac.Equal(given, computeHMAC(v.Secret, timestamp, body)) {
+		return ErrInvalidSignature
+	}
+
+	var nonce string
+	if v.NonceHeader != "" {
+		nonce = header.Get(v.NonceHeader)
+		if nonce == "" {
+			return fmt.Errorf("%w: missing %s header", ErrInvalidSignature, v.NonceHeader)
+		}
+	}
+
+	// once past the tolerance the timestamp check alone refuses
+	// it, so there's no point in remembering the nonce any longer
+	ttl := sentAt.Add(v.tolerance()).Sub(now)
+
+	// the decoded signature, so the same one spelled differently
+	// (no sha256= prefix, upper case hex) is still a replay. Anyone can
+	// send a new nonce with it, so it counts no matter the nonce
+	replayed := v.nonces().Seen("signature:"+hex.EncodeToString(given), ttl)
+
+	if nonce != "" && v.nonces().Seen("nonce:"+nonce, ttl) {
+		replayed = true
+	}
+
+	if replayed {
+		return ErrWebhookReplayed
+	}
+
+	return nil
+}
+
+// reads the raw body, with the same size limit ReadJSON uses,
+// verifies it and puts it back in place so it can be read again
+func (t *Tools) verifyWebhookBody(w http.ResponseWriter, r *http.Request) error {
+	if t.WebhookVerifier == nil {
+		return errors.New("no webhook verifier configured")
+	}
+
+	maxBytes := 1024 * 1024 // 1mb
+	if t.MaxJSONSize != 0 {
+		maxBytes = t.MaxJSONSize
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+	if err != nil {
+		return jsonDecodeError(err, maxBytes)
+	}
+
+	err = t.WebhookVerifier.Verify(r.Header, body)
+	if err != nil {
+		return err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	return nil
+}
+
+// VerifyWebhook checks the signature, timestamp and nonce of the webhook
+// with WebhookVerifier, and then decodes the verified body into data just
+// like ReadJSON does. Verification errors are mapped to 401 by ErrorJSONResponse
+func (t *Tools) VerifyWebhook(w http.ResponseWriter, r *http.Request, data interface{}) error {
+	err := t.verifyWebhookBody(w, r)
+	if err != nil {
+		return err
+	}
+
+	return t.ReadJSON(w, r, data)
+}
+
+// WebhookHandler only lets verified webhooks through to next, which can
+// then read the body with ReadJSON as usual. Anything else gets a JSON error
+func (t *Tools) WebhookHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := t.verifyWebhookBody(w, r)
+		if err != nil {
+			_ = t.ErrorJSONResponse(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
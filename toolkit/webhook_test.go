@@ -0,0 +1,190 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// builds a webhook request signed the same way PushJSONToRemote does with WithHMACSignature
+func signedWebhook(t *testing.T, secret string, sentAt time.Time, body string) *http.Request {
+	req := httptest.NewRequest("POST", "/hook", strings.NewReader(body))
+
+	signer := &HMACSigner{Secret: []byte(secret), now: func() time.Time { return sentAt }}
+	if err := signer.Sign(req, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+
+	return req
+}
+
+func TestTools_VerifyWebhook(t *testing.T) {
+	now := time.Unix(1688817600, 0)
+
+	testTools := Tools{
+		WebhookVerifier: &WebhookVerifier{
+			Secret: []byte("shhh"),
+			now:    func() time.Time { return now },
+		},
+	}
+
+	var payload struct {
+		Foo string `json:"foo"`
+	}
+
+	// a good one
+	req := signedWebhook(t, "shhh", now.Add(-time.Minute), `{"foo": "bar"}`)
+	err := testTools.VerifyWebhook(httptest.NewRecorder(), req, &payload)
+	if err != nil {
+		t.Fatalf("error not expected but got one: %s", err.Error())
+	}
+
+	if payload.Foo != "bar" {
+		t.Errorf("wrong payload decoded: %+v", payload)
+	}
+
+	// the same one again
+	req = signedWebhook(t, "shhh", now.Add(-time.Minute), `{"foo": "bar"}`)
+	err = testTools.VerifyWebhook(httptest.NewRecorder(), req, &payload)
+	if !errors.Is(err, ErrWebhookReplayed) {
+		t.Errorf("expected replay error but got %v", err)
+	}
+
+	// the same one again, spelled differently
+	for _, respell := range []func(string) string{
+		func(s string) string { return strings.TrimPrefix(s, "sha256=") },
+		func(s string) string { return "sha256=" + strings.ToUpper(strings.TrimPrefix(s, "sha256=")) },
+	} {
+		req = signedWebhook(t, "shhh", now.Add(-time.Minute), `{"foo": "bar"}`)
+		req.Header.Set("X-Signature", respell(req.Header.Get("X-Signature")))
+		err = testTools.VerifyWebhook(httptest.NewRecorder(), req, &payload)
+		if !errors.Is(err, ErrWebhookReplayed) {
+			t.Errorf("expected replay error for %s but got %v", req.Header.Get("X-Signature"), err)
+		}
+	}
+
+	// signed with another secret
+	req = signedWebhook(t, "wrong", now, `{"foo": "bar"}`)
+	err = testTools.VerifyWebhook(httptest.NewRecorder(), req, &payload)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected invalid signature but got %v", err)
+	}
+
+	// body changed after signing
+	req = signedWebhook(t, "shhh", now, `{"foo": "bar"}`)
+	req.Body = io.NopCloser(strings.NewReader(`{"foo": "baz"}`))
+	err = testTools.VerifyWebhook(httptest.NewRecorder(), req, &payload)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected invalid signature but got %v", err)
+	}
+
+	// too old
+	req = signedWebhook(t, "shhh", now.Add(-time.Hour), `{"foo": "bar"}`)
+	err = testTools.VerifyWebhook(httptest.NewRecorder(), req, &payload)
+	if !errors.Is(err, ErrWebhookExpired) {
+		t.Errorf("expected expired error but got %v", err)
+	}
+
+	// missing headers
+	req = httptest.NewRequest("POST", "/hook", strings.NewReader(`{"foo": "bar"}`))
+	req.Header.Set("X-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	err = testTools.VerifyWebhook(httptest.NewRecorder(), req, &payload)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected invalid signature but got %v", err)
+	}
+
+	// verified, but not what we expect
+	req = signedWebhook(t, "shhh", now, `{"bar": "foo"}`)
+	err = testTools.VerifyWebhook(httptest.NewRecorder(), req, &payload)
+	if err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Errorf("expected unknown key error but got %v", err)
+	}
+}
+
+func TestWebhookVerifier_NonceHeader(t *testing.T) {
+	now := time.Unix(1688817600, 0)
+
+	verifier := &WebhookVerifier{
+		Secret:      []byte("shhh"),
+		NonceHeader: "X-Nonce",
+		now:         func() time.Time { return now },
+	}
+
+	body := `{"foo": "bar"}`
+
+	req := signedWebhook(t, "shhh", now, body)
+	req.Header.Set("X-Nonce", "one")
+	if err := verifier.Verify(req.Header, []byte(body)); err != nil {
+		t.Fatalf("error not expected but got one: %s", err.Error())
+	}
+
+	// the nonce isn't signed, a new one doesn't make a captured webhook new
+	req.Header.Set("X-Nonce", "two")
+	if err := verifier.Verify(req.Header, []byte(body)); !errors.Is(err, ErrWebhookReplayed) {
+		t.Errorf("expected replay error with a new nonce but got %v", err)
+	}
+
+	// sent again with a new timestamp, but the same nonce
+	req = signedWebhook(t, "shhh", now.Add(time.Second), body)
+	req.Header.Set("X-Nonce", "one")
+	if err := verifier.Verify(req.Header, []byte(body)); !errors.Is(err, ErrWebhookReplayed) {
+		t.Errorf("expected replay error with the same nonce but got %v", err)
+	}
+
+	// a new one
+	req = signedWebhook(t, "shhh", now.Add(2*time.Second), body)
+	req.Header.Set("X-Nonce", "three")
+	if err := verifier.Verify(req.Header, []byte(body)); err != nil {
+		t.Errorf("error not expected but got one: %s", err.Error())
+	}
+
+	// no nonce
+	req = signedWebhook(t, "shhh", now.Add(3*time.Second), body)
+	if err := verifier.Verify(req.Header, []byte(body)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected invalid signature without a nonce but got %v", err)
+	}
+}
+
+func TestTools_WebhookHandler(t *testing.T) {
+	now := time.Now()
+
+	testTools := Tools{
+		WebhookVerifier: &WebhookVerifier{Secret: []byte("shhh")},
+	}
+
+	handler := testTools.WebhookHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Foo string `json:"foo"`
+		}
+
+		if err := testTools.ReadJSON(w, r, &payload); err != nil {
+			_ = testTools.ErrorJSONResponse(w, err)
+			return
+		}
+
+		_ = testTools.WriteJSON(w, http.StatusOK, JSONResponse{Message: payload.Foo})
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, signedWebhook(t, "shhh", now, `{"foo": "bar"}`))
+
+	var response JSONResponse
+	_ = json.NewDecoder(rr.Body).Decode(&response)
+
+	if rr.Code != http.StatusOK || response.Message != "bar" {
+		t.Errorf("expected the webhook to go through, got %d %+v", rr.Code, response)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, signedWebhook(t, "wrong", now, `{"foo": "bar"}`))
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 but got %d", rr.Code)
+	}
+}